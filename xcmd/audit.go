@@ -0,0 +1,246 @@
+package xcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const auditMask = "******"
+
+// DefaultMaskPatterns covers the usual names of secrets in arguments and environment variables
+var DefaultMaskPatterns = []string{"--password=", "PASSWORD", "TOKEN", "SECRET", "API_KEY"}
+
+type AuditEvent struct {
+	Cmd     string   `json:"cmd"`
+	Args    []string `json:"args"`
+	WorkDir string   `json:"workDir"`
+	// EnvSet and EnvUnset describe the environment of the command relative to the current process
+	EnvSet     map[string]string `json:"envSet,omitempty"`
+	EnvUnset   []string          `json:"envUnset,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	ExitCode   int               `json:"exitCode"`
+	OutputSize int64             `json:"outputSize"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type AuditSink interface {
+	Write(event *AuditEvent) error
+}
+
+// Auditor records every command executed by a Runner
+type Auditor struct {
+	Sink AuditSink
+	// MaskPatterns select arguments and environment variables whose values are masked,
+	// a pattern matches case-insensitively, leading dashes and a trailing "=" are ignored
+	MaskPatterns []string
+}
+
+// NewAuditor masks DefaultMaskPatterns when no patterns are given
+func NewAuditor(sink AuditSink, patterns ...string) *Auditor {
+	if len(patterns) == 0 {
+		patterns = DefaultMaskPatterns
+	}
+	return &Auditor{Sink: sink, MaskPatterns: patterns}
+}
+
+type auditRecord struct {
+	auditor *Auditor
+	event   *AuditEvent
+	output  *countingWriter
+}
+
+func (a *Auditor) begin(r *Runner) *auditRecord {
+	set, unset := diffEnv(os.Environ(), r.Env)
+	for k, v := range set {
+		set[k] = a.maskEnv(k, v)
+	}
+	return &auditRecord{
+		auditor: a,
+		event: &AuditEvent{
+			Cmd:      r.Cmd,
+			Args:     a.maskArgs(r.Args),
+			WorkDir:  r.WorkDir,
+			EnvSet:   set,
+			EnvUnset: unset,
+			Start:    time.Now(),
+			ExitCode: -1,
+		},
+		output: &countingWriter{},
+	}
+}
+
+func (rec *auditRecord) end(result *Result, err error) error {
+	rec.event.End = time.Now()
+	rec.event.OutputSize = rec.output.size.Load()
+	if result != nil {
+		rec.event.ExitCode = result.ExitCode
+	}
+	if err != nil {
+		rec.event.Error = err.Error()
+	}
+	if rec.auditor.Sink == nil {
+		return err
+	}
+	if sinkErr := rec.auditor.Sink.Write(rec.event); sinkErr != nil {
+		return errors.Join(err, fmt.Errorf("xcmd: failed to write audit event: %w", sinkErr))
+	}
+	return err
+}
+
+func (a *Auditor) match(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range a.MaskPatterns {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimLeft(pattern, "-"), "="))
+		if pattern != "" && strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskArgs masks "--name=value" and "NAME=value" values, or the argument following a "--name" flag.
+// Other positional arguments are kept, e.g. "kubectl create secret" names no secret.
+func (a *Auditor) maskArgs(args []string) []string {
+	masked := make([]string, len(args))
+	copy(masked, args)
+	for i := 0; i < len(masked); i++ {
+		arg := masked[i]
+		if name, _, ok := strings.Cut(arg, "="); ok {
+			if a.match(name) {
+				masked[i] = name + "=" + auditMask
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-") && a.match(arg) && i+1 < len(masked) {
+			masked[i+1] = auditMask
+			i++
+		}
+	}
+	return masked
+}
+
+func (a *Auditor) maskEnv(key, value string) string {
+	if a.match(key) {
+		return auditMask
+	}
+	return value
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		m[k] = v
+	}
+	return m
+}
+
+func diffEnv(base, env []string) (map[string]string, []string) {
+	baseMap := envMap(base)
+	cmdMap := envMap(env)
+	set := map[string]string{}
+	for k, v := range cmdMap {
+		if old, ok := baseMap[k]; !ok || old != v {
+			set[k] = v
+		}
+	}
+	unset := []string{}
+	for k := range baseMap {
+		if _, ok := cmdMap[k]; !ok {
+			unset = append(unset, k)
+		}
+	}
+	sort.Strings(unset)
+	return set, unset
+}
+
+// countingWriter counts the bytes written to stdout and stderr
+type countingWriter struct {
+	size atomic.Int64
+}
+
+func (c *countingWriter) wrap(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	wrappedStdout := &countedWriter{counter: c, writer: stdout}
+	if stdout == stderr {
+		return wrappedStdout, wrappedStdout
+	}
+	return wrappedStdout, &countedWriter{counter: c, writer: stderr}
+}
+
+type countedWriter struct {
+	counter *countingWriter
+	writer  io.Writer
+}
+
+func (w *countedWriter) Write(p []byte) (int, error) {
+	w.counter.size.Add(int64(len(p)))
+	if w.writer == nil {
+		return len(p), nil
+	}
+	return w.writer.Write(p)
+}
+
+// JSONLinesSink appends audit events to a file, one json object per line
+type JSONLinesSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewJSONLinesSink(path string) (*JSONLinesSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesSink{file: file}, nil
+}
+
+func (s *JSONLinesSink) Write(event *AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// MemorySink keeps audit events in memory, mainly for tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Write(event *AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func (s *MemorySink) Events() []AuditEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]AuditEvent, len(s.events))
+	copy(events, s.events)
+	return events
+}
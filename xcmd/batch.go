@@ -0,0 +1,127 @@
+package xcmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xgrpool"
+)
+
+type BatchOptions struct {
+	// Concurrency limits the number of commands running at once, defaults to the number of CPUs
+	Concurrency int
+	// FailFast cancels the remaining commands after the first failure
+	FailFast bool
+	// Timeout is applied to every single command
+	Timeout time.Duration
+	// OnProgress is called each time a command completes, calls are never concurrent.
+	// A panic in OnProgress is recovered and returned as error of RunAll.
+	OnProgress func(event BatchEvent)
+}
+
+type BatchResult struct {
+	Index  int
+	Runner *Runner
+	Result *Result
+	Err    error
+	// Skipped is set for commands that were never started because the batch was cancelled
+	Skipped bool
+}
+
+type BatchEvent struct {
+	Index     int
+	Completed int
+	Total     int
+	Result    *BatchResult
+}
+
+// RunAll runs the commands in parallel and returns their results in input order.
+// The returned error is the first failure in fail-fast mode, otherwise all failures joined.
+func RunAll(ctx context.Context, runners []*Runner, opts *BatchOptions) ([]*BatchResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pool := xgrpool.NewWithContext(ctx)
+
+	results := make([]*BatchResult, len(runners))
+	mu := sync.Mutex{}
+	completed := 0
+	var firstErr, progressErr error
+	progress := func(event BatchEvent) {
+		defer func() {
+			if e := recover(); e != nil && progressErr == nil {
+				progressErr = fmt.Errorf("xcmd: OnProgress panicked: %v", e)
+			}
+		}()
+		opts.OnProgress(event)
+	}
+	finish := func(res *BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[res.Index] = res
+		if res.Err != nil && !res.Skipped && firstErr == nil {
+			firstErr = res.Err
+			if opts.FailFast {
+				cancel()
+			}
+		}
+		completed++
+		if opts.OnProgress != nil {
+			progress(BatchEvent{Index: res.Index, Completed: completed, Total: len(runners), Result: res})
+		}
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for i, r := range runners {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			finish(&BatchResult{Index: i, Runner: r, Err: ctx.Err(), Skipped: true})
+			continue
+		}
+		pool.AddWithRecover(func(ctx context.Context) error {
+			defer func() { <-sem }()
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+			result, err := r.RunContext(ctx)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", r.Cmd, err)
+			}
+			finish(&BatchResult{Index: i, Runner: r, Result: result, Err: err})
+			return nil
+		}, func(ctx context.Context, e interface{}) {
+			finish(&BatchResult{Index: i, Runner: r, Err: fmt.Errorf("xcmd: command %d panicked: %v", i, e)})
+		})
+	}
+	pool.Wait()
+
+	if opts.FailFast {
+		return results, errors.Join(firstErr, progressErr)
+	}
+	errs := []error{}
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, res.Err)
+		}
+	}
+	return results, errors.Join(append(errs, progressErr)...)
+}
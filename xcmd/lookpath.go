@@ -0,0 +1,172 @@
+package xcmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProbeTimeout limits how long a version probe may run
+var ProbeTimeout = 10 * time.Second
+
+// KnownVersionArgs lists the version arguments of tools that do not understand --version
+var KnownVersionArgs = map[string][]string{
+	"go":    {"version"},
+	"java":  {"-version"},
+	"javac": {"-version"},
+}
+
+var probeCache = sync.Map{}
+
+type Tool struct {
+	Name    string
+	Path    string
+	Version *Version
+	// Output is the raw output of the version command
+	Output string
+}
+
+// NotFoundError lists the locations searched for an executable
+type NotFoundError struct {
+	Name     string
+	Searched []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("xcmd: executable %q not found, searched: %s; install it or add its directory to PATH",
+		e.Name, strings.Join(e.Searched, string(os.PathListSeparator)))
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return exec.ErrNotFound
+}
+
+// SearchDirs returns the extra directories followed by the directories in PATH
+func SearchDirs(extraDirs ...string) []string {
+	dirs := append([]string{}, extraDirs...)
+	return append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// LookPath searches the executable in the extra directories first and then in PATH.
+// Like exec.LookPath, a match in a relative PATH directory fails with an error wrapping exec.ErrDot.
+func LookPath(name string, extraDirs ...string) (string, error) {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.ContainsRune(name, '/') {
+		return exec.LookPath(name)
+	}
+	return lookPathIn(name, SearchDirs(extraDirs...), len(extraDirs))
+}
+
+// LookPathIn searches the executable only in the given directories
+func LookPathIn(name string, dirs ...string) (string, error) {
+	return lookPathIn(name, dirs, len(dirs))
+}
+
+// lookPathIn trusts relative directories only among the first trusted dirs, the others come from PATH
+func lookPathIn(name string, dirs []string, trusted int) (string, error) {
+	for i, dir := range dirs {
+		if dir == "" {
+			if i < trusted {
+				continue
+			}
+			dir = "." // an empty PATH entry is the current directory
+		}
+		path := filepath.Join(dir, name)
+		if !strings.ContainsRune(path, os.PathSeparator) {
+			path = "." + string(os.PathSeparator) + path // stops exec.LookPath from searching PATH
+		}
+		path, err := exec.LookPath(path)
+		if err != nil {
+			continue
+		}
+		if i >= trusted && !filepath.IsAbs(dir) {
+			return path, &exec.Error{Name: name, Err: exec.ErrDot}
+		}
+		return path, nil
+	}
+	return "", &NotFoundError{Name: name, Searched: dirs}
+}
+
+// Probe locates the executable and parses its version from the output of versionArgs,
+// re selects the version, its first group is used if it has one. Results are cached.
+func Probe(name string, versionArgs []string, re *regexp.Regexp, extraDirs ...string) (*Tool, error) {
+	if versionArgs == nil {
+		versionArgs = []string{"--version"}
+	}
+	pattern := ""
+	if re != nil {
+		pattern = re.String()
+	}
+	key := strings.Join(append([]string{name, pattern, strings.Join(extraDirs, "\x00")}, versionArgs...), "\x00")
+	if tool, ok := probeCache.Load(key); ok {
+		return tool.(*Tool), nil
+	}
+
+	path, err := LookPath(name, extraDirs...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+	defer cancel()
+	buffer := bytes.Buffer{}
+	_, err = New().SetCmd(path).SetArgs(versionArgs).SetStdout(&buffer).SetStderr(&buffer).RunContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("xcmd: failed to probe version of %s: %v", path, err)
+	}
+
+	output := buffer.String()
+	text := output
+	if re != nil {
+		m := re.FindStringSubmatch(output)
+		if m == nil {
+			return nil, fmt.Errorf("xcmd: version of %s not found in output %q", path, output)
+		}
+		text = m[0]
+		if len(m) > 1 {
+			text = m[1]
+		}
+	}
+	version, err := FindVersion(text)
+	if err != nil {
+		return nil, fmt.Errorf("xcmd: failed to parse version of %s: %v", path, err)
+	}
+	tool := &Tool{Name: name, Path: path, Version: version, Output: output}
+	probeCache.Store(key, tool)
+	return tool, nil
+}
+
+// ResetProbeCache forgets all probed tools, e.g. after installing a new version
+func ResetProbeCache() {
+	probeCache.Clear()
+}
+
+// Require probes the executable and checks its version against constraint, like ">=1.2"
+func Require(name, constraint string, extraDirs ...string) (*Tool, error) {
+	tool, err := Probe(name, KnownVersionArgs[filepath.Base(name)], nil, extraDirs...)
+	if err != nil {
+		var notFound *NotFoundError
+		if errors.As(err, &notFound) && constraint != "" {
+			return nil, fmt.Errorf("%w; version %s is required", err, constraint)
+		}
+		return nil, err
+	}
+	if constraint == "" {
+		return tool, nil
+	}
+	ok, err := tool.Version.Satisfies(constraint)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("xcmd: %s %s at %s does not satisfy %s, install a matching version or put it first in PATH",
+			name, tool.Version, tool.Path, constraint)
+	}
+	return tool, nil
+}
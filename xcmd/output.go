@@ -0,0 +1,72 @@
+package xcmd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// lineWriter splits the written data into lines and passes them to a callback
+type lineWriter struct {
+	mu       sync.Mutex
+	buffer   bytes.Buffer
+	callback func(line string)
+}
+
+func newLineWriter(callback func(line string)) *lineWriter {
+	return &lineWriter{callback: callback}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buffer.Write(p)
+	for {
+		i := bytes.IndexByte(w.buffer.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := w.buffer.Next(i + 1)
+		w.callback(string(bytes.TrimRight(line, "\r\n")))
+	}
+}
+
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buffer.Len() > 0 {
+		w.callback(string(bytes.TrimRight(w.buffer.Bytes(), "\r\n")))
+		w.buffer.Reset()
+	}
+}
+
+// outputs returns the writers passed to the process and a function flushing pending callback lines
+func (r *Runner) outputs() (stdout io.Writer, stderr io.Writer, flush func()) {
+	if r.OnOutput == nil {
+		return r.Stdout, r.Stderr, func() {}
+	}
+	// stdout and stderr are copied by separate goroutines, the callback is never called concurrently
+	mu := sync.Mutex{}
+	callback := func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		r.OnOutput(line)
+	}
+	join := func(w io.Writer, lines *lineWriter) io.Writer {
+		if w == nil {
+			return lines
+		}
+		return io.MultiWriter(w, lines)
+	}
+	outLines := newLineWriter(callback)
+	if r.Stdout == r.Stderr {
+		stdout = join(r.Stdout, outLines)
+		return stdout, stdout, outLines.Flush
+	}
+	errLines := newLineWriter(callback)
+	flush = func() {
+		outLines.Flush()
+		errLines.Flush()
+	}
+	return join(r.Stdout, outLines), join(r.Stderr, errLines), flush
+}
@@ -0,0 +1,24 @@
+package xcmd
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrPtyUnsupported = errors.New("xcmd: pseudo-terminal mode is only supported on linux")
+
+// PtyOptions runs the process attached to a pseudo-terminal, stdout and stderr are merged into Stdout
+type PtyOptions struct {
+	Rows uint16
+	Cols uint16
+	// Resize delivers window size changes to the terminal until the process exits
+	Resize <-chan WinSize
+	// Stdin is forwarded to the terminal input. The forwarding goroutine returns when Stdin ends
+	// or with its first read after the process exited, close Stdin to release it right away.
+	Stdin io.Reader
+}
+
+type WinSize struct {
+	Rows uint16
+	Cols uint16
+}
@@ -0,0 +1,155 @@
+package xcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultPtyRows = 24
+	defaultPtyCols = 80
+	// ptyDrainTimeout bounds the copy of the remaining output after the process exited
+	ptyDrainTimeout = 200 * time.Millisecond
+)
+
+type ptyConn struct {
+	opts   *PtyOptions
+	output io.Writer
+	master *os.File
+	slave  *os.File
+	fd     int
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+}
+
+// openPty allocates a terminal through /dev/ptmx and attaches its slave side to cmd
+func openPty(cmd *exec.Cmd, opts *PtyOptions, output io.Writer) (*ptyConn, error) {
+	// non-blocking so closing the master interrupts pending reads and writes
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open /dev/ptmx: %v", err)
+	}
+	p := &ptyConn{
+		opts:   opts,
+		output: output,
+		master: os.NewFile(uintptr(fd), "/dev/ptmx"),
+		fd:     fd,
+		done:   make(chan struct{}),
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		p.close()
+		return nil, fmt.Errorf("failed to unlock pty: %v", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		p.close()
+		return nil, fmt.Errorf("failed to get pty number: %v", err)
+	}
+	p.slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	rows, cols := opts.Rows, opts.Cols
+	if rows == 0 {
+		rows = defaultPtyRows
+	}
+	if cols == 0 {
+		cols = defaultPtyCols
+	}
+	if err := p.setSize(WinSize{Rows: rows, Cols: cols}); err != nil {
+		p.close()
+		return nil, err
+	}
+
+	cmd.Stdin = p.slave
+	cmd.Stdout = p.slave
+	cmd.Stderr = p.slave
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0 // stdin in the child
+	return p, nil
+}
+
+func (p *ptyConn) setSize(size WinSize) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return os.ErrClosed
+	}
+	ws := &unix.Winsize{Row: size.Rows, Col: size.Cols}
+	if err := unix.IoctlSetWinsize(p.fd, unix.TIOCSWINSZ, ws); err != nil {
+		return fmt.Errorf("failed to set pty size: %v", err)
+	}
+	return nil
+}
+
+// started releases the slave side held by the parent and starts forwarding
+func (p *ptyConn) started() {
+	p.slave.Close()
+	p.slave = nil
+	go func() {
+		defer close(p.done)
+		if p.output == nil {
+			p.output = io.Discard
+		}
+		// reading the master fails with EIO once every slave descriptor is closed
+		_, _ = io.Copy(p.output, p.master)
+	}()
+	if p.opts.Stdin != nil {
+		// returns when Stdin ends or with the first read after the master was closed
+		go io.Copy(p.master, p.opts.Stdin)
+	}
+	if p.opts.Resize != nil {
+		go func() {
+			for {
+				select {
+				case <-p.done:
+					return
+				case size, ok := <-p.opts.Resize:
+					if !ok {
+						return
+					}
+					_ = p.setSize(size)
+				}
+			}
+		}()
+	}
+}
+
+// wait copies the output left in the terminal after the process exited. Background processes
+// may keep the terminal open, their output is cut off after ptyDrainTimeout or when ctx is done.
+func (p *ptyConn) wait(ctx context.Context) {
+	timer := time.NewTimer(ptyDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	p.close()
+	<-p.done
+}
+
+func (p *ptyConn) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	if p.slave != nil {
+		p.slave.Close()
+	}
+	p.master.Close()
+}
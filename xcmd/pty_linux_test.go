@@ -0,0 +1,74 @@
+package xcmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPty(t *testing.T) {
+	buffer := bytes.Buffer{}
+	lines := []string{}
+	_, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", "test -t 1 && echo tty; stty size"}).
+		SetStdout(&buffer).
+		SetPty(&PtyOptions{Rows: 30, Cols: 100}).
+		SetOnOutput(func(line string) { lines = append(lines, line) }).
+		RunContext(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "tty\r\n30 100\r\n", buffer.String())
+	require.Equal(t, []string{"tty", "30 100"}, lines)
+}
+
+func TestPtyResize(t *testing.T) {
+	stdin, input := io.Pipe()
+	resize := make(chan WinSize)
+	buffer := bytes.Buffer{}
+	go func() {
+		resize <- WinSize{Rows: 50, Cols: 160}
+		// the second send only completes after the first size was applied
+		resize <- WinSize{Rows: 50, Cols: 160}
+		input.Write([]byte("go\n"))
+	}()
+	_, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", "read x; stty size"}).
+		SetStdout(&buffer).
+		SetPty(&PtyOptions{Resize: resize, Stdin: stdin}).
+		RunContext(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, buffer.String(), "50 160")
+	input.Close()
+}
+
+func TestPtyBackground(t *testing.T) {
+	// the background sleep ignores the hangup of the session and keeps the terminal open
+	buffer := bytes.Buffer{}
+	start := time.Now()
+	_, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", "(trap '' HUP; sleep 3) & echo done"}).
+		SetStdout(&buffer).
+		SetPty(&PtyOptions{}).
+		RunContext(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "done\r\n", buffer.String())
+	require.Less(t, time.Since(start), 2*time.Second)
+
+	// a cancelled context does not wait for the drain
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", "(trap '' HUP; sleep 3) & sleep 3"}).
+		SetPty(&PtyOptions{}).
+		RunContext(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
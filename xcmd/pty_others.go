@@ -0,0 +1,21 @@
+//go:build !linux
+
+package xcmd
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+type ptyConn struct{}
+
+func openPty(cmd *exec.Cmd, opts *PtyOptions, output io.Writer) (*ptyConn, error) {
+	return nil, ErrPtyUnsupported
+}
+
+func (p *ptyConn) started() {}
+
+func (p *ptyConn) wait(ctx context.Context) {}
+
+func (p *ptyConn) close() {}
@@ -0,0 +1,157 @@
+package xcmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RetryPolicy reruns a command that failed with a transient error
+type RetryPolicy struct {
+	// MaxAttempts includes the first run, defaults to 3
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt, defaults to 500ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, defaults to 30s
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after every attempt, defaults to 2
+	Multiplier float64
+	// Jitter randomly shortens each delay by up to this fraction, from 0 to 1
+	Jitter float64
+	// ExitCodes limits retries to these exit codes, any non-zero exit code is retried when empty
+	ExitCodes []int
+	// StderrPattern limits retries to attempts whose stderr matches
+	StderrPattern *regexp.Regexp
+	// RetryOn replaces ExitCodes and StderrPattern with a custom predicate
+	RetryOn func(exitCode int, stderr string) bool
+}
+
+// Attempt is a single run of a command with its output
+type Attempt struct {
+	Number   int
+	Start    time.Time
+	Duration time.Duration
+	ExitCode int
+	Err      error
+	Stdout   []byte
+	Stderr   []byte
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay after the given attempt, starting at 1
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial, max, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = 500 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := time.Duration(math.Min(float64(initial)*math.Pow(multiplier, float64(attempt-1)), float64(max)))
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * math.Min(p.Jitter, 1) * float64(d))
+	}
+	return d
+}
+
+func (p *RetryPolicy) retryable(exitCode int, stderr string) bool {
+	if p.RetryOn != nil {
+		return p.RetryOn(exitCode, stderr)
+	}
+	if exitCode == 0 {
+		return false
+	}
+	if len(p.ExitCodes) > 0 && !slices.Contains(p.ExitCodes, exitCode) {
+		return false
+	}
+	if p.StderrPattern != nil && !p.StderrPattern.MatchString(stderr) {
+		return false
+	}
+	return true
+}
+
+func (r *Runner) runRetry(ctx context.Context) (*Result, error) {
+	attempts := []Attempt{}
+	for n := 1; ; n++ {
+		capture := &attemptCapture{}
+		start := time.Now()
+		result, err := r.runAudited(ctx, capture.wrap)
+		attempt := Attempt{
+			Number:   n,
+			Start:    start,
+			Duration: time.Since(start),
+			ExitCode: -1,
+			Err:      err,
+			Stdout:   capture.stdout.Bytes(),
+			Stderr:   capture.stderr.Bytes(),
+		}
+		if result != nil {
+			attempt.ExitCode = result.ExitCode
+		}
+		attempts = append(attempts, attempt)
+		if result != nil {
+			result.Attempts = attempts
+		}
+
+		// failures to start the process and cancellation are never retried
+		if err == nil || result == nil || ctx.Err() != nil {
+			return result, err
+		}
+		if n >= r.Retry.maxAttempts() || !r.Retry.retryable(attempt.ExitCode, string(attempt.Stderr)) {
+			return result, err
+		}
+		delay := r.Retry.backoff(n)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return result, err
+		}
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attemptCapture keeps the output of an attempt while passing it through
+type attemptCapture struct {
+	mu     sync.Mutex
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+func (c *attemptCapture) wrap(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	// a shared lock keeps writes to the same underlying writer serialized
+	return &captureWriter{capture: c, buffer: &c.stdout, writer: stdout},
+		&captureWriter{capture: c, buffer: &c.stderr, writer: stderr}
+}
+
+type captureWriter struct {
+	capture *attemptCapture
+	buffer  *bytes.Buffer
+	writer  io.Writer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.capture.mu.Lock()
+	defer w.capture.mu.Unlock()
+	w.buffer.Write(p)
+	if w.writer == nil {
+		return len(p), nil
+	}
+	return w.writer.Write(p)
+}
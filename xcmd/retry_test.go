@@ -0,0 +1,60 @@
+//go:build unix
+
+package xcmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyScript fails with a transient error until it was run the given number of times
+const flakyScript = `n=$(cat "$1" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "$1"
+if [ $n -lt $2 ]; then echo "attempt $n: connection reset" >&2; exit 128; fi
+echo "attempt $n: ok"`
+
+func TestRetry(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	buffer := bytes.Buffer{}
+	result, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", flakyScript, "sh", counter, "3"}).
+		SetStdout(&buffer).
+		SetStderr(&buffer).
+		SetRetry(&RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: 10 * time.Millisecond,
+			Jitter:         0.5,
+			ExitCodes:      []int{128},
+			StderrPattern:  regexp.MustCompile(`connection reset`),
+		}).
+		RunContext(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, result.ExitCode)
+	require.Len(t, result.Attempts, 3)
+	require.Equal(t, 128, result.Attempts[0].ExitCode)
+	require.Error(t, result.Attempts[0].Err)
+	require.Equal(t, "attempt 2: connection reset\n", string(result.Attempts[1].Stderr))
+	require.Equal(t, "attempt 3: ok\n", string(result.Attempts[2].Stdout))
+	require.Contains(t, buffer.String(), "attempt 1: connection reset")
+}
+
+func TestRetryGiveUp(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, StderrPattern: regexp.MustCompile(`timeout`)}
+	result, err := New().SetCmd("sh").SetArgs([]string{"-c", flakyScript, "sh", counter, "3"}).SetStderr(nil).SetRetry(policy).RunContext(context.Background())
+	require.Error(t, err)
+	require.Len(t, result.Attempts, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	policy = &RetryPolicy{MaxAttempts: 5, InitialBackoff: 200 * time.Millisecond}
+	result, err = New().SetCmd("sh").SetArgs([]string{"-c", "exit 1"}).SetRetry(policy).RunContext(ctx)
+	require.Error(t, err)
+	require.Len(t, result.Attempts, 2)
+}
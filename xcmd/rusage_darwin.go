@@ -0,0 +1,13 @@
+package xcmd
+
+import (
+	"os"
+	"syscall"
+)
+
+func maxRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return int64(usage.Maxrss) // bytes
+	}
+	return 0
+}
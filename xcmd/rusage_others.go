@@ -0,0 +1,9 @@
+//go:build !unix
+
+package xcmd
+
+import "os"
+
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,15 @@
+//go:build unix && !darwin
+
+package xcmd
+
+import (
+	"os"
+	"syscall"
+)
+
+func maxRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return int64(usage.Maxrss) * 1024 // kilobytes
+	}
+	return 0
+}
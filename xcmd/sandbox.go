@@ -0,0 +1,38 @@
+package xcmd
+
+import "errors"
+
+var ErrLimitsUnsupported = errors.New("xcmd: process limits are only supported on linux")
+
+// Limits restricts the resources of a child process, zero values leave a limit unchanged.
+type Limits struct {
+	CPUSeconds   uint64 // RLIMIT_CPU
+	AddressSpace uint64 // RLIMIT_AS in bytes
+	OpenFiles    uint64 // RLIMIT_NOFILE
+	// CoreSize is RLIMIT_CORE in bytes, it is always applied so the zero value disables core dumps
+	CoreSize uint64
+	// Nice is the scheduling priority, from -20 (highest) to 19 (lowest),
+	// it is set after switching to User so negative values need privileges of User
+	Nice int
+	// User runs the process under another uid/gid, requires sufficient privileges
+	User *User
+	// Cgroup places the process into a dedicated cgroup v2, it is skipped when cgroup v2,
+	// its controllers or the permission to delegate them are unavailable
+	Cgroup *CgroupLimits
+}
+
+type User struct {
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
+}
+
+type CgroupLimits struct {
+	// Root is the cgroup the leaf group is created in, its controllers are enabled if needed.
+	// It defaults to the parent of the cgroup of the current process.
+	Root string
+	// MemoryMax is written to memory.max in bytes
+	MemoryMax int64
+	// CPUQuota is the number of CPUs the process may use, e.g. 0.5 for half a core
+	CPUQuota float64
+}
@@ -0,0 +1,246 @@
+package xcmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	cgroupMount     = "/sys/fs/cgroup"
+	cgroupCPUPeriod = 100000
+
+	// sandboxArg0 and sandboxEnv mark the re-executed binary that applies the limits
+	sandboxArg0 = "xcmd-sandbox"
+	sandboxEnv  = "XCMD_SANDBOX"
+)
+
+var errCgroupUnavailable = errors.New("cgroup v2 is unavailable")
+
+// init turns the re-executed binary into the sandbox helper before main runs
+func init() {
+	if len(os.Args) > 3 && os.Args[0] == sandboxArg0 && os.Getenv(sandboxEnv) == "1" {
+		err := sandboxExec(os.Args[1], os.Args[2], os.Args[3:])
+		fmt.Fprintf(os.Stderr, "xcmd: %v\n", err)
+		os.Exit(127)
+	}
+}
+
+type sandbox struct {
+	limits *Limits
+	dir    string
+	fd     *os.File
+}
+
+func newSandbox(limits *Limits) (*sandbox, error) {
+	return &sandbox{limits: limits}, nil
+}
+
+// prepare runs the command through this binary, which applies the rlimits and niceness
+// and execs the command, so neither it nor its children ever run without limits.
+// Package init functions of the binary run in the helper before xcmd takes over.
+func (s *sandbox) prepare(cmd *exec.Cmd) error {
+	if s.limits == nil {
+		return nil
+	}
+	if u := s.limits.User; u != nil {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: u.Uid, Gid: u.Gid, Groups: u.Groups}
+	}
+	if c := s.limits.Cgroup; c != nil {
+		// cgroups are skipped when unavailable, the process still runs with its rlimits
+		if err := s.createCgroup(c); err != nil {
+			s.close()
+			if !errors.Is(err, errCgroupUnavailable) {
+				return err
+			}
+		} else {
+			cmd.SysProcAttr.UseCgroupFD = true
+			cmd.SysProcAttr.CgroupFD = int(s.fd.Fd())
+		}
+	}
+	if cmd.Err != nil {
+		return nil // Start reports the lookup error
+	}
+	l := s.limits
+	spec := fmt.Sprintf("%d,%d,%d,%d,%d", l.CPUSeconds, l.AddressSpace, l.OpenFiles, l.CoreSize, l.Nice)
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env[:len(env):len(env)], sandboxEnv+"=1")
+	cmd.Args = append([]string{sandboxArg0, spec, cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
+
+// sandboxExec applies the limits of spec to the helper process and replaces it with path
+func sandboxExec(spec, path string, argv []string) error {
+	fields := strings.Split(spec, ",")
+	if len(fields) != 5 {
+		return fmt.Errorf("invalid sandbox spec %q", spec)
+	}
+	values := make([]uint64, 4)
+	for i := range values {
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid sandbox spec %q", spec)
+		}
+		values[i] = v
+	}
+	nice, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return fmt.Errorf("invalid sandbox spec %q", spec)
+	}
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, sandboxEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice); err != nil {
+			return fmt.Errorf("failed to set nice: %v", err)
+		}
+	}
+	// the address space is limited last, the helper must not allocate afterwards
+	rlimits := []struct {
+		resource int
+		value    uint64
+		always   bool
+	}{
+		{syscall.RLIMIT_CPU, values[0], false},
+		{syscall.RLIMIT_NOFILE, values[2], false},
+		{syscall.RLIMIT_CORE, values[3], true},
+		{syscall.RLIMIT_AS, values[1], false},
+	}
+	for _, l := range rlimits {
+		if l.value == 0 && !l.always {
+			continue
+		}
+		// syscall.Setrlimit also stops Exec from restoring the original RLIMIT_NOFILE
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("failed to set rlimit %d: %v", l.resource, err)
+		}
+	}
+	return syscall.Exec(path, argv, env)
+}
+
+func (s *sandbox) cgroup() bool {
+	return s.fd != nil
+}
+
+func (s *sandbox) close() {
+	if s.fd != nil {
+		s.fd.Close()
+		s.fd = nil
+	}
+	if s.dir != "" {
+		// kill processes left behind by the child, otherwise the cgroup cannot be removed
+		_ = os.WriteFile(filepath.Join(s.dir, "cgroup.kill"), []byte("1"), 0)
+		_ = os.Remove(s.dir)
+		s.dir = ""
+	}
+}
+
+// createCgroup creates a leaf cgroup for the process and enables its controllers on the parent,
+// cgroup v2 only allows controllers in groups without processes of their own
+func (s *sandbox) createCgroup(c *CgroupLimits) error {
+	root := c.Root
+	if root == "" {
+		self, err := selfCgroup()
+		if err != nil {
+			return fmt.Errorf("%w: %v", errCgroupUnavailable, err)
+		}
+		// the cgroup of the current process holds processes, the leaf is created next to it
+		root = self
+		if self != cgroupMount {
+			root = filepath.Dir(self)
+		}
+	}
+	controllers := []string{}
+	if c.MemoryMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if c.CPUQuota > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	available, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("%w at %s: %v", errCgroupUnavailable, root, err)
+	}
+	enabled, err := os.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("%w at %s: %v", errCgroupUnavailable, root, err)
+	}
+	enable := []string{}
+	for _, controller := range controllers {
+		if !slices.Contains(strings.Fields(string(available)), controller) {
+			return fmt.Errorf("%w: controller %s is not available at %s", errCgroupUnavailable, controller, root)
+		}
+		if !slices.Contains(strings.Fields(string(enabled)), controller) {
+			enable = append(enable, "+"+controller)
+		}
+	}
+	if len(enable) > 0 {
+		// EBUSY: root holds processes, e.g. the namespace root of a container
+		if err := writeCgroupFile(root, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+			return fmt.Errorf("%w: failed to enable controllers at %s: %v", errCgroupUnavailable, root, err)
+		}
+	}
+	dir, err := os.MkdirTemp(root, "xcmd-")
+	if err != nil {
+		if os.IsPermission(err) || errors.Is(err, syscall.EROFS) {
+			return fmt.Errorf("%w: %v", errCgroupUnavailable, err)
+		}
+		return err
+	}
+	s.dir = dir
+	if c.MemoryMax > 0 {
+		if err := writeCgroupFile(dir, "memory.max", strconv.FormatInt(c.MemoryMax, 10)); err != nil {
+			return err
+		}
+	}
+	if c.CPUQuota > 0 {
+		quota := fmt.Sprintf("%d %d", int64(c.CPUQuota*cgroupCPUPeriod), cgroupCPUPeriod)
+		if err := writeCgroupFile(dir, "cpu.max", quota); err != nil {
+			return err
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	s.fd = fd
+	return nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+}
+
+// selfCgroup returns the cgroup v2 directory of the current process
+func selfCgroup() (string, error) {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroupMount, path), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("cgroup v2 hierarchy not found in /proc/self/cgroup")
+}
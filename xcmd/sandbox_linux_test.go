@@ -0,0 +1,72 @@
+package xcmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cgroupV2Usable reports whether the tests can delegate memory and cpu to a leaf cgroup
+func cgroupV2Usable() bool {
+	controllers, err := os.ReadFile(filepath.Join(cgroupMount, "cgroup.controllers"))
+	if err != nil || os.Geteuid() != 0 {
+		return false
+	}
+	fields := strings.Fields(string(controllers))
+	return slices.Contains(fields, "memory") && slices.Contains(fields, "cpu")
+}
+
+func TestLimits(t *testing.T) {
+	buffer := bytes.Buffer{}
+	// the limits are in place from the first instruction and inherited by children
+	script := `ulimit -n; ulimit -c; sh -c 'ulimit -n'; cut -d' ' -f19 /proc/self/stat; cgroup=$(sed -n 's/^0:://p' /proc/self/cgroup); cat /sys/fs/cgroup$cgroup/memory.max /sys/fs/cgroup$cgroup/cpu.max 2>/dev/null; true`
+	result, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", script}).
+		SetStdout(&buffer).
+		SetLimits(&Limits{OpenFiles: 64, Nice: 5, Cgroup: &CgroupLimits{MemoryMax: 64 << 20, CPUQuota: 0.5}}).
+		RunContext(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, result.ExitCode)
+	require.Greater(t, result.MaxRSS, int64(0))
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Equal(t, []string{"64", "0", "64", "5"}, lines[:4])
+	if cgroupV2Usable() {
+		require.True(t, result.Cgroup)
+		require.Equal(t, []string{"67108864", "50000 100000"}, lines[4:])
+	} else {
+		t.Log("cgroup v2 with memory and cpu is unavailable")
+		require.False(t, result.Cgroup)
+	}
+}
+
+func TestLimitsEnv(t *testing.T) {
+	buffer := bytes.Buffer{}
+	_, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", "echo $0 $1; head -c 2 /proc/$$/cmdline; echo; env | grep -c " + sandboxEnv + " || true", "zero", "one"}).
+		SetEnv([]string{"PATH=" + os.Getenv("PATH")}).
+		SetStdout(&buffer).
+		SetLimits(&Limits{OpenFiles: 32}).
+		RunContext(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "zero one\nsh\n0\n", buffer.String())
+}
+
+func TestLimitsCPU(t *testing.T) {
+	result, err := New().
+		SetCmd("sh").
+		SetArgs([]string{"-c", "while :; do :; done"}).
+		SetLimits(&Limits{CPUSeconds: 1}).
+		RunContext(context.Background())
+	require.Error(t, err)
+	require.NotEqual(t, 0, result.ExitCode)
+	require.GreaterOrEqual(t, result.UserTime+result.SystemTime, time.Second/2)
+}
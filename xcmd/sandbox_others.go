@@ -0,0 +1,24 @@
+//go:build !linux
+
+package xcmd
+
+import "os/exec"
+
+type sandbox struct{}
+
+func newSandbox(limits *Limits) (*sandbox, error) {
+	if limits != nil {
+		return nil, ErrLimitsUnsupported
+	}
+	return &sandbox{}, nil
+}
+
+func (s *sandbox) prepare(cmd *exec.Cmd) error {
+	return nil
+}
+
+func (s *sandbox) cgroup() bool {
+	return false
+}
+
+func (s *sandbox) close() {}
@@ -0,0 +1,147 @@
+package xcmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionRegexp = regexp.MustCompile(`v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?`)
+
+// Version is a semantic version, a missing minor or patch number is parsed as zero
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string
+}
+
+func ParseVersion(s string) (*Version, error) {
+	s = strings.TrimSpace(s)
+	m := versionRegexp.FindStringSubmatch(s)
+	if m == nil || m[0] != s {
+		return nil, fmt.Errorf("invalid version: %q", s)
+	}
+	v := &Version{Pre: m[4]}
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version: %q", s)
+		}
+		*p = n
+	}
+	return v, nil
+}
+
+// FindVersion extracts the first version found in text
+func FindVersion(text string) (*Version, error) {
+	m := versionRegexp.FindString(text)
+	if m == "" {
+		return nil, fmt.Errorf("no version found in %q", text)
+	}
+	return ParseVersion(m)
+}
+
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1, pre-releases are ordered before the release
+func (v *Version) Compare(o *Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				return compareInt(an, bn)
+			}
+		case aerr == nil:
+			return -1 // numeric identifiers have lower precedence
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Satisfies checks a constraint like ">=1.2" or ">=1.2, <2", all comma separated terms must match
+func (v *Version) Satisfies(constraint string) (bool, error) {
+	for _, term := range strings.Split(constraint, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		op := term[:len(term)-len(strings.TrimLeft(term, "<>=!"))]
+		want, err := ParseVersion(strings.TrimSpace(term[len(op):]))
+		if err != nil {
+			return false, fmt.Errorf("invalid constraint %q: %v", constraint, err)
+		}
+		c := v.Compare(want)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = c >= 0
+		case ">":
+			ok = c > 0
+		case "<=":
+			ok = c <= 0
+		case "<":
+			ok = c < 0
+		case "", "=", "==":
+			ok = c == 0
+		case "!=":
+			ok = c != 0
+		default:
+			return false, fmt.Errorf("invalid constraint %q: unknown operator %q", constraint, op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
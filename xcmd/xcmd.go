@@ -2,11 +2,12 @@ package xcmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
-	"runtime"
-	"syscall"
+	"time"
 )
 
 type Runner struct {
@@ -16,6 +17,26 @@ type Runner struct {
 	Env     []string
 	Stdout  io.Writer
 	Stderr  io.Writer
+	Limits  *Limits
+	Pty     *PtyOptions
+	Auditor *Auditor
+	Retry   *RetryPolicy
+	// OnOutput receives the output line by line in addition to Stdout and Stderr
+	OnOutput func(line string)
+}
+
+// Result describes a finished process
+type Result struct {
+	ExitCode   int
+	Duration   time.Duration
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSS is the peak resident set size in bytes
+	MaxRSS int64
+	// Cgroup reports whether the process was placed into a dedicated cgroup
+	Cgroup bool
+	// Attempts records every run when a retry policy is set
+	Attempts []Attempt
 }
 
 func New() *Runner {
@@ -64,16 +85,123 @@ func (r *Runner) SetStderr(stderr io.Writer) *Runner {
 	return r
 }
 
+func (r *Runner) SetLimits(limits *Limits) *Runner {
+	r.Limits = limits
+	return r
+}
+
+func (r *Runner) SetPty(pty *PtyOptions) *Runner {
+	r.Pty = pty
+	return r
+}
+
+func (r *Runner) SetOnOutput(callback func(line string)) *Runner {
+	r.OnOutput = callback
+	return r
+}
+
+func (r *Runner) SetAuditor(auditor *Auditor) *Runner {
+	r.Auditor = auditor
+	return r
+}
+
+func (r *Runner) SetRetry(retry *RetryPolicy) *Runner {
+	r.Retry = retry
+	return r
+}
+
 func (r *Runner) Run() error {
-	cmd := exec.Command(r.Cmd, r.Args...)
+	_, err := r.RunContext(context.Background())
+	return err
+}
+
+// RunContext runs the command and waits for it, the process is killed when ctx is done.
+// The result is returned whenever the process was started, even if it exited with an error.
+func (r *Runner) RunContext(ctx context.Context) (*Result, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if r.Retry != nil {
+		return r.runRetry(ctx)
+	}
+	return r.runAudited(ctx)
+}
+
+// outputWrapper decorates the writers of a single run
+type outputWrapper func(stdout, stderr io.Writer) (io.Writer, io.Writer)
+
+func (r *Runner) runAudited(ctx context.Context, wrappers ...outputWrapper) (*Result, error) {
+	if r.Auditor == nil {
+		return r.run(ctx, wrappers...)
+	}
+	record := r.Auditor.begin(r)
+	result, err := r.run(ctx, append(wrappers, record.output.wrap)...)
+	return result, record.end(result, err)
+}
+
+func (r *Runner) run(ctx context.Context, wrappers ...outputWrapper) (*Result, error) {
+	cmd := exec.CommandContext(ctx, r.Cmd, r.Args...)
 	cmd.Dir = r.WorkDir
 	cmd.Env = r.Env
-	cmd.Stdout = r.Stdout
-	cmd.Stderr = r.Stderr
-	if runtime.GOOS == "windows" {
-		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	stdout, stderr, flush := r.outputs()
+	defer flush()
+	for _, wrap := range wrappers {
+		stdout, stderr = wrap(stdout, stderr)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = sysProcAttr()
+
+	var pty *ptyConn
+	if r.Pty != nil {
+		p, err := openPty(cmd, r.Pty, stdout)
+		if err != nil {
+			return nil, err
+		}
+		defer p.close()
+		pty = p
+	}
+
+	sb, err := newSandbox(r.Limits)
+	if err != nil {
+		return nil, err
+	}
+	defer sb.close()
+	if err := sb.prepare(cmd); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if pty != nil {
+		pty.started()
+	}
+	err = cmd.Wait()
+	if pty != nil {
+		pty.wait(ctx)
+	}
+
+	result := &Result{
+		ExitCode: -1,
+		Duration: time.Since(start),
+		Cgroup:   sb.cgroup(),
+	}
+	if state := cmd.ProcessState; state != nil {
+		result.ExitCode = state.ExitCode()
+		result.UserTime = state.UserTime()
+		result.SystemTime = state.SystemTime()
+		result.MaxRSS = maxRSS(state)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return result, err
+	}
+	if err != nil && ctx.Err() != nil {
+		return result, ctx.Err()
 	}
-	return cmd.Run()
+	return result, err
 }
 
 func Run(cmd string, args ...string) error {
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package xcmd
+
+import "syscall"
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}
@@ -1,7 +1,17 @@
 package xcmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -11,3 +21,203 @@ func TestCmd(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, version, "go version go")
 }
+
+func TestRunContext(t *testing.T) {
+	result, err := New().SetCmd("go").SetArgs([]string{"version"}).SetStdout(io.Discard).RunContext(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, result.ExitCode)
+	require.Greater(t, result.Duration, time.Duration(0))
+}
+
+func TestRunAll(t *testing.T) {
+	runners := []*Runner{}
+	for i := 0; i < 6; i++ {
+		args := []string{"version"}
+		if i == 3 {
+			args = []string{"no-such-command"}
+		}
+		runners = append(runners, New().SetCmd("go").SetArgs(args).SetStdout(io.Discard).SetStderr(io.Discard))
+	}
+
+	events := []BatchEvent{}
+	results, err := RunAll(context.Background(), runners, &BatchOptions{
+		Concurrency: 2,
+		OnProgress:  func(event BatchEvent) { events = append(events, event) },
+	})
+	require.Error(t, err)
+	require.Len(t, results, 6)
+	require.Len(t, events, 6)
+	require.Equal(t, 6, events[5].Completed)
+	for i, res := range results {
+		require.Equal(t, i, res.Index)
+		require.Same(t, runners[i], res.Runner)
+		if i == 3 {
+			require.Error(t, res.Err)
+			require.NotEqual(t, 0, res.Result.ExitCode)
+		} else {
+			require.NoError(t, res.Err)
+		}
+	}
+
+	results, err = RunAll(context.Background(), runners, &BatchOptions{Concurrency: 1, FailFast: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exit status")
+	require.NoError(t, results[2].Err)
+	require.True(t, results[4].Skipped)
+	require.True(t, results[5].Skipped)
+}
+
+func TestRunAllPanic(t *testing.T) {
+	results, err := RunAll(context.Background(), []*Runner{nil}, nil)
+	require.Error(t, err)
+	require.Contains(t, results[0].Err.Error(), "panicked")
+
+	// a panicking callback neither replaces the result nor counts it twice
+	events := []BatchEvent{}
+	runners := []*Runner{New().SetCmd("go").SetArgs([]string{"version"}).SetStdout(io.Discard), New().SetCmd("go").SetArgs([]string{"version"}).SetStdout(io.Discard)}
+	results, err = RunAll(context.Background(), runners, &BatchOptions{Concurrency: 1, OnProgress: func(event BatchEvent) {
+		events = append(events, event)
+		if event.Index == 0 {
+			panic("progress bar closed")
+		}
+	}})
+	require.ErrorContains(t, err, "OnProgress panicked: progress bar closed")
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	require.Len(t, events, 2)
+	require.Equal(t, 2, events[1].Completed)
+}
+
+func TestAudit(t *testing.T) {
+	sink := NewMemorySink()
+	auditor := NewAuditor(sink, DefaultMaskPatterns...)
+	buffer := bytes.Buffer{}
+	_, err := New().
+		SetCmd("go").
+		SetArgs([]string{"version", "--password=secret", "--token", "secret", "-v"}).
+		AddEnv("GITHUB_TOKEN=secret", "XCMD_AUDIT=1").
+		SetStdout(&buffer).
+		SetAuditor(auditor).
+		RunContext(context.Background())
+	require.Error(t, err)
+
+	events := sink.Events()
+	require.Len(t, events, 1)
+	event := events[0]
+	require.Equal(t, "go", event.Cmd)
+	require.Equal(t, []string{"version", "--password=******", "--token", "******", "-v"}, event.Args)
+	require.Equal(t, "******", event.EnvSet["GITHUB_TOKEN"])
+	require.Equal(t, "1", event.EnvSet["XCMD_AUDIT"])
+	require.NotEqual(t, 0, event.ExitCode)
+	require.NotEmpty(t, event.Error)
+	require.False(t, event.End.Before(event.Start))
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	fileSink, err := NewJSONLinesSink(path)
+	require.NoError(t, err)
+	buffer.Reset()
+	err = New().SetCmd("go").SetArgs([]string{"version"}).SetStdout(&buffer).SetAuditor(NewAuditor(fileSink)).Run()
+	require.NoError(t, err)
+	require.NoError(t, fileSink.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &event))
+	require.Equal(t, 0, event.ExitCode)
+	require.Equal(t, int64(buffer.Len()), event.OutputSize)
+}
+
+func TestAuditMaskArgs(t *testing.T) {
+	// no patterns mask the defaults
+	auditor := NewAuditor(nil)
+	for args, want := range map[string]string{
+		"create secret generic x":             "create secret generic x",
+		"login --token abc --verbose":         "login --token ****** --verbose",
+		"login -password abc":                 "login -password ******",
+		"deploy --password=abc API_TOKEN=xyz": "deploy --password=****** API_TOKEN=******",
+		"run --secret":                        "run --secret",
+		"set name=secret-value mode=password": "set name=secret-value mode=password",
+	} {
+		require.Equal(t, want, strings.Join(auditor.maskArgs(strings.Fields(args)), " "), args)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	v, err := ParseVersion("v1.2.3-rc.1")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3-rc.1", v.String())
+
+	v, err = FindVersion("go version go1.21 linux/amd64")
+	require.NoError(t, err)
+	require.Equal(t, "1.21.0", v.String())
+
+	for constraint, want := range map[string]bool{
+		">=1.2":        true,
+		">=1.21, <2":   true,
+		"<1.21":        false,
+		"1.21":         true,
+		"!=1.21.0":     false,
+		">1.21.0-beta": true,
+	} {
+		ok, err := v.Satisfies(constraint)
+		require.NoError(t, err)
+		require.Equal(t, want, ok, constraint)
+	}
+	_, err = v.Satisfies("~>1.0")
+	require.Error(t, err)
+
+	rc, _ := ParseVersion("1.0.0-rc.1")
+	alpha, _ := ParseVersion("1.0.0-alpha")
+	release, _ := ParseVersion("1.0.0")
+	require.Equal(t, -1, rc.Compare(release))
+	require.Equal(t, 1, rc.Compare(alpha))
+}
+
+func TestRequire(t *testing.T) {
+	tool, err := Require("go", ">=1.11")
+	require.NoError(t, err)
+	require.NotEmpty(t, tool.Path)
+	require.Contains(t, tool.Output, "go version")
+
+	_, err = Require("go", "<1.0")
+	require.ErrorContains(t, err, tool.Path)
+
+	dir := t.TempDir()
+	_, err = Require("xcmd-no-such-tool", ">=1.0", dir)
+	require.ErrorIs(t, err, exec.ErrNotFound)
+	require.ErrorContains(t, err, dir)
+
+	path, err := LookPathIn("go", filepath.Dir(tool.Path))
+	require.NoError(t, err)
+	require.Equal(t, tool.Path, path)
+}
+
+func TestLookPathDot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the planted tool is a shell script")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "xcmd-planted"), []byte("#!/bin/sh\necho planted 9.9.9\n"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "xcmd-planted"), []byte("#!/bin/sh\necho planted 9.9.9\n"), 0755))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	for _, path := range []string{".", "", "sub/..", "bin"} {
+		t.Setenv("PATH", path+string(os.PathListSeparator)+os.Getenv("PATH"))
+		_, err = LookPath("xcmd-planted")
+		require.ErrorIs(t, err, exec.ErrDot, path)
+		_, err = Require("xcmd-planted", ">=1.0")
+		require.ErrorIs(t, err, exec.ErrDot, path)
+	}
+
+	// directories given by the caller are trusted
+	path, err := LookPath("xcmd-planted", ".")
+	require.NoError(t, err)
+	require.Equal(t, "./xcmd-planted", path)
+	path, err = LookPath("xcmd-planted", dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "xcmd-planted"), path)
+}
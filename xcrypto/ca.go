@@ -0,0 +1,117 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"time"
+)
+
+const (
+	DefaultCAName     = "xcrypto CA"
+	DefaultCAValidity = time.Hour * 24 * 365 * 3
+	// DefaultBackdate tolerates clients whose clock is behind
+	DefaultBackdate = time.Hour * 48
+)
+
+// CA is a certificate authority able to issue certificates
+type CA struct {
+	Key  crypto.Signer
+	Cert *x509.Certificate
+	// Registry records the certificates issued by Sign when set
+	Registry *SerialRegistry
+}
+
+type CAOptions struct {
+	KeyAlgorithm KeyAlgorithm
+	RSABits      int
+	// Subject defaults to DefaultCAName as common name and organization
+	Subject pkix.Name
+	// NotBefore defaults to now minus DefaultBackdate
+	NotBefore time.Time
+	// NotAfter defaults to NotBefore plus Validity
+	NotAfter time.Time
+	Validity time.Duration
+	// MaxPathLen limits the depth of intermediate CAs, like x509.Certificate
+	MaxPathLen     int
+	MaxPathLenZero bool
+	// Name constraints of the certificates issued by the CA
+	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
+	PermittedIPRanges   []*net.IPNet
+	ExcludedIPRanges    []*net.IPNet
+	// KeyUsage defaults to certificate and CRL signing
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// CreateCA generates a key and a self-signed CA certificate
+func CreateCA(opts *CAOptions) (*CA, error) {
+	if opts == nil {
+		opts = &CAOptions{}
+	}
+	key, err := GenerateKey(opts.KeyAlgorithm, opts.RSABits)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := RandomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	subject := opts.Subject
+	if subject.CommonName == "" {
+		subject.CommonName = DefaultCAName
+	}
+	if len(subject.Organization) == 0 {
+		subject.Organization = []string{subject.CommonName}
+	}
+	notBefore := opts.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now().Add(-DefaultBackdate)
+	}
+	notAfter := opts.NotAfter
+	if notAfter.IsZero() {
+		validity := opts.Validity
+		if validity <= 0 {
+			validity = DefaultCAValidity
+		}
+		notAfter = notBefore.Add(validity)
+	}
+	keyUsage := opts.KeyUsage
+	if keyUsage == 0 {
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            opts.MaxPathLen,
+		MaxPathLenZero:        opts.MaxPathLenZero,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           opts.ExtKeyUsage,
+		PermittedDNSDomains:   opts.PermittedDNSDomains,
+		ExcludedDNSDomains:    opts.ExcludedDNSDomains,
+		PermittedIPRanges:     opts.PermittedIPRanges,
+		ExcludedIPRanges:      opts.ExcludedIPRanges,
+	}
+	if len(opts.PermittedDNSDomains) > 0 || len(opts.PermittedIPRanges) > 0 {
+		template.PermittedDNSDomainsCritical = true
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Key: key, Cert: cert}, nil
+}
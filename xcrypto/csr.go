@@ -0,0 +1,382 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const PEMTypeCertificateRequest = "CERTIFICATE REQUEST"
+
+var oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+type extKeyUsageOID struct {
+	oid   asn1.ObjectIdentifier
+	usage x509.ExtKeyUsage
+}
+
+var extKeyUsageOIDs = []extKeyUsageOID{
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, x509.ExtKeyUsageServerAuth},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}, x509.ExtKeyUsageClientAuth},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}, x509.ExtKeyUsageCodeSigning},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}, x509.ExtKeyUsageEmailProtection},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}, x509.ExtKeyUsageTimeStamping},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}, x509.ExtKeyUsageOCSPSigning},
+}
+
+type CSROptions struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+	// ExtKeyUsage requests extended key usages, the CA decides whether to grant them
+	ExtKeyUsage     []x509.ExtKeyUsage
+	ExtraExtensions []pkix.Extension
+}
+
+// CreateCSR creates a certificate signing request signed by key
+func CreateCSR(key crypto.Signer, opts *CSROptions) (*x509.CertificateRequest, error) {
+	if opts == nil {
+		opts = &CSROptions{}
+	}
+	template := &x509.CertificateRequest{
+		Subject:         opts.Subject,
+		DNSNames:        opts.DNSNames,
+		IPAddresses:     opts.IPAddresses,
+		EmailAddresses:  opts.EmailAddresses,
+		URIs:            opts.URIs,
+		ExtraExtensions: opts.ExtraExtensions,
+	}
+	if len(opts.ExtKeyUsage) > 0 {
+		oids := []asn1.ObjectIdentifier{}
+		for _, usage := range opts.ExtKeyUsage {
+			for _, u := range extKeyUsageOIDs {
+				if u.usage == usage {
+					oids = append(oids, u.oid)
+				}
+			}
+		}
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oidExtKeyUsage, Value: value})
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificateRequest(der)
+}
+
+func EncodeCSR(csr *x509.CertificateRequest) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeCertificateRequest, Bytes: csr.Raw})
+}
+
+// ParseCSR parses a PEM or DER request and validates it
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	der := data
+	if isPEM(data) {
+		block, _ := pem.Decode(data)
+		if block == nil || (block.Type != PEMTypeCertificateRequest && block.Type != "NEW CERTIFICATE REQUEST") {
+			return nil, errors.New("xcrypto: no certificate request found")
+		}
+		der = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCSR(csr); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+// ValidateCSR checks the signature and the requested names
+func ValidateCSR(csr *x509.CertificateRequest) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("xcrypto: invalid request signature: %v", err)
+	}
+	if csr.Subject.CommonName == "" && len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 &&
+		len(csr.EmailAddresses) == 0 && len(csr.URIs) == 0 {
+		return errors.New("xcrypto: request has no subject name")
+	}
+	for _, name := range csr.DNSNames {
+		if !validDNSName(name) {
+			return fmt.Errorf("xcrypto: invalid dns name %q", name)
+		}
+	}
+	return nil
+}
+
+func validDNSName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// requestedExtKeyUsage returns the extended key usages requested by the CSR
+func requestedExtKeyUsage(csr *x509.CertificateRequest) ([]x509.ExtKeyUsage, error) {
+	usages := []x509.ExtKeyUsage{}
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidExtKeyUsage) {
+			continue
+		}
+		var oids []asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+			return nil, fmt.Errorf("xcrypto: invalid extended key usage extension: %v", err)
+		}
+		for _, oid := range oids {
+			i := slices.IndexFunc(extKeyUsageOIDs, func(u extKeyUsageOID) bool { return u.oid.Equal(oid) })
+			if i < 0 {
+				return nil, fmt.Errorf("xcrypto: unsupported extended key usage %v", oid)
+			}
+			usages = append(usages, extKeyUsageOIDs[i].usage)
+		}
+	}
+	return usages, nil
+}
+
+// IssuancePolicy restricts what a CA signs, empty lists do not restrict
+// except for IP addresses, URIs and email addresses, which are rejected unless allowed
+type IssuancePolicy struct {
+	// AllowedDomains are exact names, "*.example.com" allows any subdomain of example.com.
+	// They also restrict the subject common name.
+	AllowedDomains []string
+	// AllowedURIs are exact URIs, a trailing "*" allows any URI with the prefix, e.g. "spiffe://example.org/ns/prod/*"
+	AllowedURIs []string
+	// AllowedEmails are exact addresses, "@example.com" allows any address at example.com
+	AllowedEmails []string
+	// AllowedIPRanges must contain every requested IP address, IP addresses are rejected when empty
+	AllowedIPRanges []*net.IPNet
+	AllowIPs        bool
+	// MaxValidity of issued certificates, defaults to DefaultLeafValidity
+	MaxValidity     time.Duration
+	AllowedKeyTypes []KeyAlgorithm
+	// MinRSABits defaults to 2048
+	MinRSABits int
+	// AllowedExtKeyUsages limits requested usages, DefaultExtKeyUsage is issued when a request has none
+	AllowedExtKeyUsages []x509.ExtKeyUsage
+	DefaultExtKeyUsage  []x509.ExtKeyUsage
+}
+
+func (p *IssuancePolicy) maxValidity() time.Duration {
+	if p.MaxValidity <= 0 {
+		return DefaultLeafValidity
+	}
+	return p.MaxValidity
+}
+
+// Check returns an error describing the first violation of the policy,
+// only the common name of the subject is checked and issued
+func (p *IssuancePolicy) Check(csr *x509.CertificateRequest) error {
+	names := csr.DNSNames
+	ips := csr.IPAddresses
+	// the common name is still used as host name by legacy clients
+	if cn := csr.Subject.CommonName; cn != "" {
+		if ip := net.ParseIP(cn); ip != nil {
+			ips = append([]net.IP{ip}, ips...)
+		} else {
+			names = append([]string{cn}, names...)
+		}
+	}
+	for _, name := range names {
+		if len(p.AllowedDomains) > 0 && !slices.ContainsFunc(p.AllowedDomains, func(pattern string) bool { return domainAllowed(pattern, name) }) {
+			return fmt.Errorf("xcrypto: policy does not allow name %q", name)
+		}
+	}
+	for _, u := range csr.URIs {
+		if !slices.ContainsFunc(p.AllowedURIs, func(pattern string) bool { return uriAllowed(pattern, u) }) {
+			return fmt.Errorf("xcrypto: policy does not allow uri %q", u)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !slices.ContainsFunc(p.AllowedEmails, func(pattern string) bool { return emailAllowed(pattern, email) }) {
+			return fmt.Errorf("xcrypto: policy does not allow email address %q", email)
+		}
+	}
+	for _, ip := range ips {
+		if !p.AllowIPs {
+			return fmt.Errorf("xcrypto: policy does not allow ip address %s", ip)
+		}
+		if len(p.AllowedIPRanges) > 0 && !slices.ContainsFunc(p.AllowedIPRanges, func(r *net.IPNet) bool { return r.Contains(ip) }) {
+			return fmt.Errorf("xcrypto: policy does not allow ip address %s", ip)
+		}
+	}
+
+	alg, bits, err := keyAlgorithmOf(csr.PublicKey)
+	if err != nil {
+		return err
+	}
+	if len(p.AllowedKeyTypes) > 0 && !slices.Contains(p.AllowedKeyTypes, alg) {
+		return fmt.Errorf("xcrypto: policy does not allow %v keys", alg)
+	}
+	minBits := p.MinRSABits
+	if minBits <= 0 {
+		minBits = DefaultRSABits
+	}
+	if alg == RSA && bits < minBits {
+		return fmt.Errorf("xcrypto: RSA key of %d bits is shorter than %d bits", bits, minBits)
+	}
+
+	usages, err := requestedExtKeyUsage(csr)
+	if err != nil {
+		return err
+	}
+	for _, usage := range usages {
+		if len(p.AllowedExtKeyUsages) > 0 && !slices.Contains(p.AllowedExtKeyUsages, usage) {
+			return fmt.Errorf("xcrypto: policy does not allow extended key usage %s", extKeyUsageNames[usage])
+		}
+	}
+	return nil
+}
+
+func domainAllowed(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if parent, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(name, "."+parent)
+	}
+	return pattern == name
+}
+
+func uriAllowed(pattern string, u *url.URL) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		// dot segments could climb out of the prefix
+		return strings.HasPrefix(u.String(), prefix) && u.RawQuery == "" && u.Fragment == "" && u.Path == path.Clean(u.Path)
+	}
+	return pattern == u.String()
+}
+
+func emailAllowed(pattern, email string) bool {
+	pattern, email = strings.ToLower(pattern), strings.ToLower(email)
+	if strings.HasPrefix(pattern, "@") {
+		return strings.HasSuffix(email, pattern) && strings.Count(email, "@") == 1
+	}
+	return pattern == email
+}
+
+func keyAlgorithmOf(key crypto.PublicKey) (KeyAlgorithm, int, error) {
+	keyType, bits := publicKeyInfo(key)
+	switch keyType {
+	case "RSA":
+		return RSA, bits, nil
+	case "ECDSA-P-256":
+		return ECDSAP256, bits, nil
+	case "ECDSA-P-384":
+		return ECDSAP384, bits, nil
+	case "Ed25519":
+		return Ed25519, bits, nil
+	default:
+		return 0, 0, fmt.Errorf("xcrypto: unsupported public key %s", keyType)
+	}
+}
+
+// Sign issues a certificate for the request after checking it against the policy
+func (ca *CA) Sign(csr *x509.CertificateRequest, policy *IssuancePolicy) (*x509.Certificate, error) {
+	if policy == nil {
+		policy = &IssuancePolicy{}
+	}
+	return ca.SignWithValidity(csr, policy, policy.maxValidity())
+}
+
+// SignWithValidity is Sign with a validity shorter than the maximum of the policy
+func (ca *CA) SignWithValidity(csr *x509.CertificateRequest, policy *IssuancePolicy, validity time.Duration) (*x509.Certificate, error) {
+	if policy == nil {
+		policy = &IssuancePolicy{}
+	}
+	if err := ValidateCSR(csr); err != nil {
+		return nil, err
+	}
+	if err := policy.Check(csr); err != nil {
+		return nil, err
+	}
+	if validity <= 0 || validity > policy.maxValidity() {
+		return nil, fmt.Errorf("xcrypto: validity %v exceeds the policy maximum %v", validity, policy.maxValidity())
+	}
+	extKeyUsage, _ := requestedExtKeyUsage(csr)
+	if len(extKeyUsage) == 0 {
+		extKeyUsage = policy.DefaultExtKeyUsage
+	}
+	if len(extKeyUsage) == 0 {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, ok := csr.PublicKey.(*rsa.PublicKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	serial, err := ca.nextSerial()
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-5 * time.Minute)
+	notAfter := notBefore.Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: csr.Subject.CommonName},
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		EmailAddresses: csr.EmailAddresses,
+		URIs:           csr.URIs,
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+		KeyUsage:       keyUsage,
+		ExtKeyUsage:    extKeyUsage,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, csr.PublicKey, ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if ca.Registry != nil {
+		if err := ca.Registry.Record(cert); err != nil {
+			return nil, err
+		}
+	}
+	return cert, nil
+}
+
+func (ca *CA) nextSerial() (*big.Int, error) {
+	for {
+		serial, err := RandomSerialNumber()
+		if err != nil {
+			return nil, err
+		}
+		if ca.Registry == nil || !ca.Registry.Contains(serial) {
+			return serial, nil
+		}
+	}
+}
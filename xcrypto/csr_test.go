@@ -0,0 +1,134 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSR(t *testing.T) {
+	key := mustKey(t, ECDSAP256)
+	csr, err := CreateCSR(key, &CSROptions{
+		Subject:     pkix.Name{CommonName: "api.example.com"},
+		DNSNames:    []string{"api.example.com", "*.api.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.1.2.3")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+
+	parsed, err := ParseCSR(EncodeCSR(csr))
+	require.NoError(t, err)
+	require.Equal(t, csr.DNSNames, parsed.DNSNames)
+	parsed, err = ParseCSR(csr.Raw)
+	require.NoError(t, err)
+	usages, err := requestedExtKeyUsage(parsed)
+	require.NoError(t, err)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, usages)
+
+	bad, err := CreateCSR(key, &CSROptions{DNSNames: []string{"bad name.com"}})
+	require.NoError(t, err)
+	require.Error(t, ValidateCSR(bad))
+	empty, err := CreateCSR(key, nil)
+	require.NoError(t, err)
+	require.Error(t, ValidateCSR(empty))
+}
+
+func TestCASign(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP256})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "serials.jsonl")
+	ca.Registry, err = OpenSerialRegistry(path)
+	require.NoError(t, err)
+
+	policy := &IssuancePolicy{
+		AllowedDomains:      []string{"example.com", "*.example.com"},
+		AllowIPs:            true,
+		AllowedIPRanges:     []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}},
+		MaxValidity:         30 * 24 * time.Hour,
+		AllowedKeyTypes:     []KeyAlgorithm{ECDSAP256, RSA},
+		AllowedExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	sign := func(key crypto.Signer, opts *CSROptions) (*x509.Certificate, error) {
+		csr, err := CreateCSR(key, opts)
+		require.NoError(t, err)
+		return ca.Sign(csr, policy)
+	}
+
+	key := mustKey(t, ECDSAP256)
+	cert, err := sign(key, &CSROptions{
+		Subject:     pkix.Name{CommonName: "api.example.com"},
+		DNSNames:    []string{"api.example.com", "example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.1.2.3")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+	require.NoError(t, cert.CheckSignatureFrom(ca.Cert))
+	require.True(t, PublicKeyEqual(key.Public(), cert.PublicKey))
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, cert.ExtKeyUsage)
+	require.LessOrEqual(t, cert.NotAfter.Sub(cert.NotBefore), 30*24*time.Hour)
+
+	cert, err = sign(key, &CSROptions{DNSNames: []string{"www.example.com"}})
+	require.NoError(t, err)
+	require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+
+	_, err = sign(key, &CSROptions{DNSNames: []string{"example.org"}})
+	require.ErrorContains(t, err, "example.org")
+	_, err = sign(key, &CSROptions{DNSNames: []string{"example.com"}, IPAddresses: []net.IP{net.ParseIP("192.168.1.1")}})
+	require.ErrorContains(t, err, "192.168.1.1")
+	_, err = sign(mustKey(t, Ed25519), &CSROptions{DNSNames: []string{"example.com"}})
+	require.ErrorContains(t, err, "Ed25519")
+	_, err = sign(key, &CSROptions{DNSNames: []string{"example.com"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}})
+	require.ErrorContains(t, err, "CodeSigning")
+	csr, err := CreateCSR(key, &CSROptions{DNSNames: []string{"example.com"}})
+	require.NoError(t, err)
+	_, err = ca.SignWithValidity(csr, policy, 31*24*time.Hour)
+	require.Error(t, err)
+
+	// every common name is checked, other subject fields are not issued
+	_, err = sign(key, &CSROptions{Subject: pkix.Name{CommonName: "intranet"}, DNSNames: []string{"example.com"}})
+	require.ErrorContains(t, err, "intranet")
+	_, err = sign(key, &CSROptions{Subject: pkix.Name{CommonName: "192.168.1.1"}, DNSNames: []string{"example.com"}})
+	require.ErrorContains(t, err, "192.168.1.1")
+	subject, err := sign(key, &CSROptions{Subject: pkix.Name{CommonName: "example.com", Organization: []string{"Bank"}}})
+	require.NoError(t, err)
+	require.Equal(t, "CN=example.com", subject.Subject.String())
+
+	// uris and email addresses are rejected unless allowed
+	spiffe := func(id string) *CSROptions {
+		u, err := url.Parse(id)
+		require.NoError(t, err)
+		return &CSROptions{DNSNames: []string{"example.com"}, URIs: []*url.URL{u}}
+	}
+	_, err = sign(key, spiffe("spiffe://example.org/ns/prod/sa/api"))
+	require.ErrorContains(t, err, "spiffe://example.org/ns/prod/sa/api")
+	_, err = sign(key, &CSROptions{EmailAddresses: []string{"admin@example.com"}})
+	require.ErrorContains(t, err, "admin@example.com")
+	policy.AllowedURIs = []string{"spiffe://example.org/ns/prod/*"}
+	policy.AllowedEmails = []string{"@example.com"}
+	cert, err = sign(key, spiffe("spiffe://example.org/ns/prod/sa/api"))
+	require.NoError(t, err)
+	require.Equal(t, "spiffe://example.org/ns/prod/sa/api", cert.URIs[0].String())
+	_, err = sign(key, spiffe("spiffe://example.org/ns/admin/sa/api"))
+	require.Error(t, err)
+	_, err = sign(key, spiffe("spiffe://example.org/ns/prod/../admin/sa/api"))
+	require.Error(t, err)
+	_, err = sign(key, &CSROptions{EmailAddresses: []string{"Admin@Example.com"}})
+	require.NoError(t, err)
+	_, err = sign(key, &CSROptions{EmailAddresses: []string{"admin@example.org"}})
+	require.Error(t, err)
+
+	registry, err := OpenSerialRegistry(path)
+	require.NoError(t, err)
+	records := registry.List()
+	require.Len(t, records, 5)
+	require.Equal(t, []string{"api.example.com", "example.com", "10.1.2.3"}, records[0].Names)
+	require.True(t, registry.Contains(cert.SerialNumber))
+	require.Error(t, registry.Record(cert))
+}
@@ -0,0 +1,97 @@
+package xcrypto
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashAlgorithm names a digest, the names match the tools printing them, e.g. sha256sum and b2sum
+type HashAlgorithm string
+
+const (
+	MD5        HashAlgorithm = "md5"
+	SHA1       HashAlgorithm = "sha1"
+	SHA256     HashAlgorithm = "sha256"
+	SHA512     HashAlgorithm = "sha512"
+	CRC32      HashAlgorithm = "crc32"
+	BLAKE2b256 HashAlgorithm = "blake2b-256"
+	BLAKE2b512 HashAlgorithm = "blake2b-512"
+)
+
+// HashAlgorithms are all supported algorithms
+var HashAlgorithms = []HashAlgorithm{MD5, SHA1, SHA256, SHA512, CRC32, BLAKE2b256, BLAKE2b512}
+
+func (a HashAlgorithm) New() (hash.Hash, error) {
+	switch a {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case CRC32:
+		return crc32.NewIEEE(), nil
+	case BLAKE2b256:
+		return blake2b.New256(nil)
+	case BLAKE2b512:
+		return blake2b.New512(nil)
+	}
+	return nil, fmt.Errorf("xcrypto: unsupported hash algorithm %q", a)
+}
+
+// Digests are lower case hex digests by algorithm
+type Digests map[HashAlgorithm]string
+
+// HashReader reads r once and feeds every algorithm, SHA256 is used without algorithms
+func HashReader(r io.Reader, algs ...HashAlgorithm) (Digests, int64, error) {
+	if len(algs) == 0 {
+		algs = []HashAlgorithm{SHA256}
+	}
+	hashes := make(map[HashAlgorithm]hash.Hash, len(algs))
+	writers := make([]io.Writer, 0, len(algs))
+	for _, alg := range algs {
+		if _, ok := hashes[alg]; ok {
+			continue
+		}
+		h, err := alg.New()
+		if err != nil {
+			return nil, 0, err
+		}
+		hashes[alg] = h
+		writers = append(writers, h)
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return nil, n, err
+	}
+	digests := make(Digests, len(hashes))
+	for alg, h := range hashes {
+		digests[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return digests, n, nil
+}
+
+func HashFile(path string, algs ...HashAlgorithm) (Digests, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	digests, _, err := HashReader(f, algs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return digests, nil
+}
@@ -0,0 +1,118 @@
+package xcrypto
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashReader(t *testing.T) {
+	// python hashlib and zlib
+	expected := Digests{
+		MD5:        "9e107d9d372bb6826bd81d3542a419d6",
+		SHA1:       "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12",
+		SHA256:     "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+		SHA512:     "07e547d9586f6a73f73fbac0435ed76951218fb7d0c8d788a309d785436bbb642e93a252a954f23912547d1e8a3b5ed6e1bfd7097821233fa0538f3db854fee6",
+		CRC32:      "414fa339",
+		BLAKE2b256: "01718cec35cd3d796dd00020e0bfecb473ad23457d063b75eff29c0ffa2e58a9",
+		BLAKE2b512: "a8add4bdddfd93e4877d2746e62817b116364a1fa7bc148d95090bc7333b3673f82401cf7aa2e4cb1ecd90296e3f14cb5413f8ed77be73045b13914cdcd6a918",
+	}
+	data := "The quick brown fox jumps over the lazy dog"
+	digests, n, err := HashReader(strings.NewReader(data), HashAlgorithms...)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, expected, digests)
+
+	digests, _, err = HashReader(strings.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, Digests{SHA256: expected[SHA256]}, digests)
+
+	path := filepath.Join(t.TempDir(), "fox.txt")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	digests, err = HashFile(path, MD5, CRC32, MD5)
+	require.NoError(t, err)
+	require.Equal(t, Digests{MD5: expected[MD5], CRC32: expected[CRC32]}, digests)
+
+	_, _, err = HashReader(strings.NewReader(data), "md4")
+	require.Error(t, err)
+	_, err = HashFile(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":          "a",
+		"sub/b.txt":      "b",
+		"sub/deep/c.bin": strings.Repeat("c", 100000),
+		"back\\slash":    "escaped",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	m, err := CreateManifest(dir, &ManifestOptions{Workers: 3})
+	require.NoError(t, err)
+	require.Equal(t, SHA256, m.Algorithm)
+	require.Len(t, m.Files, len(files))
+	require.Equal(t, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", m.Files["a.txt"])
+
+	sums := filepath.Join(dir, SumsFiles[SHA256])
+	require.NoError(t, m.Save(sums))
+	content, err := os.ReadFile(sums)
+	require.NoError(t, err)
+	require.Contains(t, string(content), m.Files["a.txt"]+"  a.txt\n")
+	require.Contains(t, string(content), "\\"+m.Files["back\\slash"]+"  back\\\\slash\n")
+
+	// the manifest itself is neither hashed nor extra
+	report, err := m.Verify(dir, nil)
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%+v", report)
+
+	if sha256sum, err := exec.LookPath("sha256sum"); err == nil {
+		cmd := exec.Command(sha256sum, "--check", "--quiet", SumsFiles[SHA256])
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	loaded, err := LoadManifest(sums)
+	require.NoError(t, err)
+	require.Equal(t, m, loaded)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub/b.txt"), []byte("B"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub/new.txt"), []byte("new"), 0644))
+	report, err = loaded.Verify(dir, &ManifestOptions{Workers: 1})
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, []string{"sub/b.txt"}, report.Modified)
+	require.Equal(t, []string{"a.txt"}, report.Missing)
+	require.Equal(t, []string{"sub/new.txt"}, report.Extra)
+
+	// other algorithms and binary mode lines
+	m, err = CreateManifest(dir, &ManifestOptions{Algorithm: BLAKE2b512, Exclude: func(path string) bool {
+		return strings.HasPrefix(path, "sub/")
+	}})
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	parsed, err := ParseManifest(strings.NewReader(
+		"# comment\n"+m.Files["back\\slash"]+" *back\\slash\r\n"), BLAKE2b512)
+	require.NoError(t, err)
+	require.Equal(t, m.Files["back\\slash"], parsed.Files["back\\slash"])
+
+	parsed, err = ParseManifest(strings.NewReader("9E107D9D372BB6826BD81D3542A419D6  ./x\n"), "")
+	require.NoError(t, err)
+	require.Equal(t, MD5, parsed.Algorithm)
+	require.Equal(t, map[string]string{"x": "9e107d9d372bb6826bd81d3542a419d6"}, parsed.Files)
+
+	for _, invalid := range []string{"xyz  file\n", "9e107d9d372bb6826bd81d3542a419d6 file\n", "9e107d9d372bb6826bd81d3542a419d6  \n", "abc  file\n"} {
+		_, err := ParseManifest(strings.NewReader(invalid), "")
+		require.ErrorIs(t, err, ErrInvalidManifest, invalid)
+	}
+}
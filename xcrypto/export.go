@@ -0,0 +1,114 @@
+package xcrypto
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	CACertDERFile     = "ca.cer"
+	CAPKCS12File      = "ca.p12"
+	CAFingerprintFile = "ca-fingerprint.txt"
+)
+
+type CAExportOptions struct {
+	// Password protects the PKCS#12 file, it is not written without a password
+	Password string
+	// IncludeKey adds the private key to the PKCS#12 file, clients only need the certificate
+	IncludeKey bool
+	// Legacy writes a PKCS#12 file for older clients, see PKCS12Options
+	Legacy bool
+}
+
+// ExportCA writes the CA certificate for installation on clients to dir:
+// ca.pem with a fingerprint header, ca.cer as DER, ca.p12 and ca-fingerprint.txt
+func ExportCA(dir string, ca *CA, opts *CAExportOptions) error {
+	if opts == nil {
+		opts = &CAExportOptions{}
+	}
+	info := CertificateFingerprintText(ca.Cert)
+	comment := "# " + strings.ReplaceAll(strings.TrimSuffix(info, "\n"), "\n", "\n# ") + "\n"
+	pemData := append([]byte(comment), EncodeCertificates(PEM, ca.Cert)...)
+	if err := writeFile(filepath.Join(dir, CACertFile), pemData, 0644); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, CACertDERFile), ca.Cert.Raw, 0644); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, CAFingerprintFile), []byte(info), 0644); err != nil {
+		return err
+	}
+	if opts.Password == "" {
+		return nil
+	}
+	var key any
+	perm := os.FileMode(0644)
+	if opts.IncludeKey {
+		key, perm = ca.Key, 0600
+	}
+	p12, err := EncodePKCS12(key, []*x509.Certificate{ca.Cert}, opts.Password, &PKCS12Options{Legacy: opts.Legacy})
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, CAPKCS12File), p12, perm)
+}
+
+// CertificateFingerprintText lets users compare an installed certificate with its fingerprints
+func CertificateFingerprintText(cert *x509.Certificate) string {
+	info := Inspect(cert)
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "Subject: %s\n", info.Subject)
+	fmt.Fprintf(&b, "Issuer: %s\n", info.Issuer)
+	fmt.Fprintf(&b, "Serial Number: %s\n", info.SerialNumber)
+	fmt.Fprintf(&b, "Not Before: %s\n", info.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Not After: %s\n", info.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "SHA-256 Fingerprint: %s\n", info.SHA256Fingerprint)
+	fmt.Fprintf(&b, "SHA-1 Fingerprint: %s\n", info.SHA1Fingerprint)
+	return b.String()
+}
+
+// BuildCertPool combines the system roots, the certificates of every PEM or DER file in dirs and certs.
+// Files in dirs that contain no certificate, e.g. keys, are skipped.
+func BuildCertPool(systemRoots bool, dirs []string, certs ...*x509.Certificate) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if systemRoots {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system roots: %w", err)
+		}
+		pool = system
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".pem", ".crt", ".cer", ".der":
+			default:
+				continue
+			}
+			// symlinks, e.g. the hash links of /etc/ssl/certs, are followed
+			path := filepath.Join(dir, entry.Name())
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+			found, err := LoadCertificates(path)
+			if err != nil {
+				continue
+			}
+			for _, cert := range found {
+				pool.AddCert(cert)
+			}
+		}
+	}
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
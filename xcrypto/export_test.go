@@ -0,0 +1,174 @@
+package xcrypto
+
+import (
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pkcs12"
+)
+
+func opensslPKCS12(t *testing.T, path, password string, args ...string) string {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is not installed")
+	}
+	out, err := exec.Command(openssl, append([]string{"pkcs12", "-in", path, "-passin", "pass:" + password, "-nodes"}, args...)...).CombinedOutput()
+	require.NoError(t, err, string(out))
+	return string(out)
+}
+
+func TestPKCS12KDF(t *testing.T) {
+	// x/crypto/pkcs12 test vectors, the second one has leading zeros in an input block
+	key := pkcs12KDF(sha1.New, []byte("\xff\xff\xff\xff\xff\xff\xff\xff"), bmpPassword("sesame"), 2048, 1, 24)
+	require.Equal(t, "7cd9fd3e2b3be7691a44e3bef0f9ea0fb9b897d4e325d9d1", hex.EncodeToString(key))
+	key = pkcs12KDF(sha1.New, []byte("\xf3\x7e\x05\xb5\x18\x32\x4b\x4b"), []byte{0, 0}, 2048, 1, 24)
+	require.Equal(t, "00f759ff47d14dd03665d5943cb3c4a39a2555c02aed66e1", hex.EncodeToString(key))
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	defer func(iterations int) { PBKDF2Iterations = iterations }(PBKDF2Iterations)
+	PBKDF2Iterations = 1000
+
+	ca, err := createMitmCA(t)
+	require.NoError(t, err)
+	leaf := signLeaf(t, ca, "leaf.example.com")
+	dir := t.TempDir()
+	for _, legacy := range []bool{false, true} {
+		opts := &PKCS12Options{Legacy: legacy, FriendlyName: "debug proxy"}
+		data, err := EncodePKCS12(ca.Key, []*x509.Certificate{ca.Cert}, "pässword", opts)
+		require.NoError(t, err)
+		path := filepath.Join(dir, "key.p12")
+		require.NoError(t, os.WriteFile(path, data, 0600))
+		out := opensslPKCS12(t, path, "pässword")
+		require.Contains(t, out, "friendlyName: debug proxy")
+		key, err := ParsePrivateKey([]byte(out), nil)
+		require.NoError(t, err)
+		require.True(t, PublicKeyEqual(ca.Key.Public(), key.Public()))
+		certs, err := ParseCertificates([]byte(out))
+		require.NoError(t, err)
+		require.Equal(t, []*x509.Certificate{ca.Cert}, certs)
+
+		require.Error(t, exec.Command("openssl", "pkcs12", "-in", path, "-passin", "pass:wrong", "-nodes").Run())
+
+		// a trust store without a key and with a chain
+		data, err = EncodePKCS12(nil, []*x509.Certificate{leaf, ca.Cert}, "", opts)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+		out = opensslPKCS12(t, path, "")
+		require.NotContains(t, out, "PRIVATE KEY")
+		certs, err = ParseCertificates([]byte(out))
+		require.NoError(t, err)
+		require.Equal(t, []*x509.Certificate{leaf, ca.Cert}, certs)
+	}
+
+	// x/crypto/pkcs12 only decodes the legacy format
+	data, err := EncodePKCS12(ca.Key, []*x509.Certificate{ca.Cert}, "secret", &PKCS12Options{Legacy: true})
+	require.NoError(t, err)
+	key, cert, err := pkcs12.Decode(data, "secret")
+	require.NoError(t, err)
+	require.Equal(t, ca.Cert.Raw, cert.Raw)
+	require.True(t, PublicKeyEqual(ca.Key.Public(), key.(*rsa.PrivateKey).Public()))
+	_, _, err = pkcs12.Decode(data, "wrong")
+	require.Error(t, err)
+
+	_, err = EncodePKCS12(mustKey(t, ECDSAP256), []*x509.Certificate{ca.Cert}, "secret", nil)
+	require.Error(t, err)
+	_, err = EncodePKCS12(nil, nil, "secret", nil)
+	require.Error(t, err)
+}
+
+func TestExportCA(t *testing.T) {
+	defer func(iterations int) { PBKDF2Iterations = iterations }(PBKDF2Iterations)
+	PBKDF2Iterations = 1000
+
+	ca, err := createMitmCA(t)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, ExportCA(dir, ca, &CAExportOptions{Password: "secret"}))
+
+	pemData, err := os.ReadFile(filepath.Join(dir, CACertFile))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(pemData), "# Subject: CN=mitmproxy,O=mitmproxy\n"))
+	require.Contains(t, string(pemData), "# SHA-256 Fingerprint: "+FingerprintSHA256(ca.Cert)+"\n")
+	cert, err := LoadCertificate(filepath.Join(dir, CACertFile))
+	require.NoError(t, err)
+	require.Equal(t, ca.Cert, cert)
+	cert, err = LoadCertificate(filepath.Join(dir, CACertDERFile))
+	require.NoError(t, err)
+	require.Equal(t, ca.Cert, cert)
+	text, err := os.ReadFile(filepath.Join(dir, CAFingerprintFile))
+	require.NoError(t, err)
+	require.Equal(t, CertificateFingerprintText(ca.Cert), string(text))
+	require.Contains(t, string(text), "SHA-1 Fingerprint: "+FingerprintSHA1(ca.Cert))
+
+	out := opensslPKCS12(t, filepath.Join(dir, CAPKCS12File), "secret")
+	require.NotContains(t, out, "PRIVATE KEY")
+	info, err := os.Stat(filepath.Join(dir, CAPKCS12File))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	withKey := t.TempDir()
+	require.NoError(t, ExportCA(withKey, ca, &CAExportOptions{Password: "secret", IncludeKey: true}))
+	require.Contains(t, opensslPKCS12(t, filepath.Join(withKey, CAPKCS12File), "secret"), "PRIVATE KEY")
+	info, err = os.Stat(filepath.Join(withKey, CAPKCS12File))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// without a password no PKCS#12 file is written
+	plain := t.TempDir()
+	require.NoError(t, ExportCA(plain, ca, nil))
+	require.NoFileExists(t, filepath.Join(plain, CAPKCS12File))
+}
+
+func TestBuildCertPool(t *testing.T) {
+	ca, err := createMitmCA(t)
+	require.NoError(t, err)
+	other := createRegistryCA(t, ECDSAP256)
+	third := createRegistryCA(t, Ed25519)
+	leaf := signLeaf(t, ca, "leaf.example.com")
+	otherLeaf := signLeaf(t, other, "other.example.com")
+	thirdLeaf := signLeaf(t, third, "third.example.com")
+
+	dir := t.TempDir()
+	require.NoError(t, ExportCA(dir, other, nil))
+	require.NoError(t, SavePrivateKey(filepath.Join(dir, "key.pem"), other.Key, PKCS8, nil))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a certificate"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, CACertFile), filepath.Join(dir, "linked.crt")))
+
+	pool, err := BuildCertPool(false, []string{dir}, ca.Cert)
+	require.NoError(t, err)
+	verify := func(cert *x509.Certificate) error {
+		_, err := cert.Verify(x509.VerifyOptions{Roots: pool})
+		return err
+	}
+	require.NoError(t, verify(leaf))
+	require.NoError(t, verify(otherLeaf))
+	require.Error(t, verify(thirdLeaf))
+
+	pool, err = BuildCertPool(true, nil, third.Cert)
+	require.NoError(t, err)
+	require.NoError(t, verify(thirdLeaf))
+	require.Error(t, verify(leaf))
+
+	_, err = BuildCertPool(false, []string{filepath.Join(dir, "missing")})
+	require.Error(t, err)
+}
+
+// createMitmCA wraps the key and certificate of CreateX508Cert
+func createMitmCA(t *testing.T) (*CA, error) {
+	key, cert, err := CreateX508Cert()
+	if err != nil {
+		return nil, err
+	}
+	ca := &CA{Key: key, Cert: cert}
+	ca.Registry, err = OpenSerialRegistry(filepath.Join(t.TempDir(), "serials.jsonl"))
+	return ca, err
+}
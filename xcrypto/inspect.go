@@ -0,0 +1,254 @@
+package xcrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CertInfo is a readable summary of a certificate
+type CertInfo struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serialNumber"`
+	DNSNames           []string  `json:"dnsNames,omitempty"`
+	IPAddresses        []string  `json:"ipAddresses,omitempty"`
+	EmailAddresses     []string  `json:"emailAddresses,omitempty"`
+	URIs               []string  `json:"uris,omitempty"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	DaysRemaining      int       `json:"daysRemaining"`
+	IsCA               bool      `json:"isCA"`
+	KeyType            string    `json:"keyType"`
+	KeySize            int       `json:"keySize"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	SHA1Fingerprint    string    `json:"sha1Fingerprint"`
+	SHA256Fingerprint  string    `json:"sha256Fingerprint"`
+	KeyUsages          []string  `json:"keyUsages,omitempty"`
+	ExtKeyUsages       []string  `json:"extKeyUsages,omitempty"`
+	SubjectKeyID       string    `json:"subjectKeyId,omitempty"`
+	AuthorityKeyID     string    `json:"authorityKeyId,omitempty"`
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "DigitalSignature"},
+	{x509.KeyUsageContentCommitment, "ContentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "KeyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "DataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "KeyAgreement"},
+	{x509.KeyUsageCertSign, "CertSign"},
+	{x509.KeyUsageCRLSign, "CRLSign"},
+	{x509.KeyUsageEncipherOnly, "EncipherOnly"},
+	{x509.KeyUsageDecipherOnly, "DecipherOnly"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "Any",
+	x509.ExtKeyUsageServerAuth:                     "ServerAuth",
+	x509.ExtKeyUsageClientAuth:                     "ClientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "CodeSigning",
+	x509.ExtKeyUsageEmailProtection:                "EmailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "IPSECEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "IPSECTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "IPSECUser",
+	x509.ExtKeyUsageTimeStamping:                   "TimeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "MicrosoftServerGatedCrypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "NetscapeServerGatedCrypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "MicrosoftCommercialCodeSigning",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "MicrosoftKernelCodeSigning",
+}
+
+// Inspect summarizes the certificate
+func Inspect(cert *x509.Certificate) *CertInfo {
+	info := &CertInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       colonHex(cert.SerialNumber.Bytes()),
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DaysRemaining:      int(time.Until(cert.NotAfter).Hours() / 24),
+		IsCA:               cert.IsCA,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SHA1Fingerprint:    FingerprintSHA1(cert),
+		SHA256Fingerprint:  FingerprintSHA256(cert),
+		SubjectKeyID:       colonHex(cert.SubjectKeyId),
+		AuthorityKeyID:     colonHex(cert.AuthorityKeyId),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	info.KeyType, info.KeySize = publicKeyInfo(cert.PublicKey)
+	for _, u := range keyUsageNames {
+		if cert.KeyUsage&u.usage != 0 {
+			info.KeyUsages = append(info.KeyUsages, u.name)
+		}
+	}
+	for _, u := range cert.ExtKeyUsage {
+		name, ok := extKeyUsageNames[u]
+		if !ok {
+			name = fmt.Sprintf("ExtKeyUsage(%d)", u)
+		}
+		info.ExtKeyUsages = append(info.ExtKeyUsages, name)
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		info.ExtKeyUsages = append(info.ExtKeyUsages, oid.String())
+	}
+	return info
+}
+
+func publicKeyInfo(key any) (string, int) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return "RSA", k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + k.Curve.Params().Name, k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	default:
+		return fmt.Sprintf("%T", key), 0
+	}
+}
+
+// FingerprintSHA256 returns the SHA-256 of the certificate as colon separated hex
+func FingerprintSHA256(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return colonHex(sum[:])
+}
+
+// FingerprintSHA1 returns the SHA-1 of the certificate as colon separated hex
+func FingerprintSHA1(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return colonHex(sum[:])
+}
+
+func colonHex(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+type VerifyReason string
+
+const (
+	ReasonExpired          VerifyReason = "expired"
+	ReasonNotYetValid      VerifyReason = "not yet valid"
+	ReasonNameMismatch     VerifyReason = "name mismatch"
+	ReasonUnknownAuthority VerifyReason = "unknown authority"
+	ReasonKeyUsage         VerifyReason = "key usage"
+	ReasonNameConstraints  VerifyReason = "name constraints"
+	ReasonInvalid          VerifyReason = "invalid"
+)
+
+// VerifyError explains which check of the chain verification failed
+type VerifyError struct {
+	Reason VerifyReason
+	// Cert is the certificate that failed the check
+	Cert   *x509.Certificate
+	Detail string
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("xcrypto: certificate verification failed (%s): %s", e.Reason, e.Detail)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyChain verifies the leaf for TLS server authentication of host, an empty host skips the
+// name check and nil roots use the system roots. Failures are returned as *VerifyError.
+func VerifyChain(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, host string) ([][]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, cert := range intermediates {
+		opts.Intermediates.AddCert(cert)
+	}
+	if roots != nil {
+		opts.Roots = x509.NewCertPool()
+		for _, cert := range roots {
+			opts.Roots.AddCert(cert)
+		}
+	}
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		return nil, explainVerifyError(leaf, err)
+	}
+	return chains, nil
+}
+
+func explainVerifyError(leaf *x509.Certificate, err error) error {
+	var invalid x509.CertificateInvalidError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	now := time.Now()
+	switch {
+	case errors.As(err, &invalid):
+		cert := invalid.Cert
+		if cert == nil {
+			cert = leaf
+		}
+		name := describeCert(cert)
+		switch invalid.Reason {
+		case x509.Expired:
+			if now.Before(cert.NotBefore) {
+				return &VerifyError{Reason: ReasonNotYetValid, Cert: cert, Err: err,
+					Detail: fmt.Sprintf("%s is not valid before %s", name, cert.NotBefore.Format(time.RFC3339))}
+			}
+			return &VerifyError{Reason: ReasonExpired, Cert: cert, Err: err,
+				Detail: fmt.Sprintf("%s expired at %s, %d days ago", name, cert.NotAfter.Format(time.RFC3339), int(now.Sub(cert.NotAfter).Hours()/24))}
+		case x509.IncompatibleUsage:
+			return &VerifyError{Reason: ReasonKeyUsage, Cert: cert, Err: err,
+				Detail: fmt.Sprintf("%s with extended key usages %v is not valid for server authentication", name, Inspect(cert).ExtKeyUsages)}
+		case x509.NotAuthorizedToSign:
+			return &VerifyError{Reason: ReasonKeyUsage, Cert: cert, Err: err,
+				Detail: fmt.Sprintf("%s is not allowed to sign certificates", name)}
+		case x509.CANotAuthorizedForThisName:
+			return &VerifyError{Reason: ReasonNameConstraints, Cert: cert, Err: err,
+				Detail: fmt.Sprintf("name constraints of the chain do not permit %s: %s", name, invalid.Detail)}
+		default:
+			return &VerifyError{Reason: ReasonInvalid, Cert: cert, Err: err, Detail: err.Error()}
+		}
+	case errors.As(err, &hostErr):
+		names := append([]string{}, hostErr.Certificate.DNSNames...)
+		for _, ip := range hostErr.Certificate.IPAddresses {
+			names = append(names, ip.String())
+		}
+		return &VerifyError{Reason: ReasonNameMismatch, Cert: hostErr.Certificate, Err: err,
+			Detail: fmt.Sprintf("%q is not one of the names %v of %s", hostErr.Host, names, describeCert(hostErr.Certificate))}
+	case errors.As(err, &authErr):
+		cert := authErr.Cert
+		if cert == nil {
+			cert = leaf
+		}
+		return &VerifyError{Reason: ReasonUnknownAuthority, Cert: cert, Err: err,
+			Detail: fmt.Sprintf("issuer %q of %s is not a trusted root and no intermediate links to one", cert.Issuer.String(), describeCert(cert))}
+	default:
+		return &VerifyError{Reason: ReasonInvalid, Cert: leaf, Err: err, Detail: err.Error()}
+	}
+}
+
+func describeCert(cert *x509.Certificate) string {
+	return fmt.Sprintf("certificate %q", cert.Subject.String())
+}
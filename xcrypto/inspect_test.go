@@ -0,0 +1,127 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP384, Subject: pkix.Name{CommonName: "Inspect CA"}})
+	require.NoError(t, err)
+	leaf, err := issueLeaf(ca, mustKey(t, RSA), []string{"example.com", "127.0.0.1"}, 30*24*time.Hour)
+	require.NoError(t, err)
+
+	info := Inspect(leaf.Leaf)
+	require.Equal(t, "CN=example.com,O=example.com", info.Subject)
+	require.Equal(t, "CN=Inspect CA,O=Inspect CA", info.Issuer)
+	require.Equal(t, []string{"example.com"}, info.DNSNames)
+	require.Equal(t, []string{"127.0.0.1"}, info.IPAddresses)
+	require.Contains(t, []int{29, 30}, info.DaysRemaining)
+	require.Equal(t, "RSA", info.KeyType)
+	require.Equal(t, 2048, info.KeySize)
+	require.Equal(t, "ECDSA-SHA384", info.SignatureAlgorithm)
+	require.Len(t, info.SHA256Fingerprint, 32*3-1)
+	require.Len(t, info.SHA1Fingerprint, 20*3-1)
+	require.Equal(t, []string{"DigitalSignature", "KeyEncipherment"}, info.KeyUsages)
+	require.Equal(t, []string{"ServerAuth", "ClientAuth"}, info.ExtKeyUsages)
+	require.Equal(t, Inspect(ca.Cert).SubjectKeyID, info.AuthorityKeyID)
+
+	info = Inspect(ca.Cert)
+	require.True(t, info.IsCA)
+	require.Equal(t, "ECDSA-P-384", info.KeyType)
+	require.Equal(t, 384, info.KeySize)
+}
+
+func TestVerifyChain(t *testing.T) {
+	root, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP256})
+	require.NoError(t, err)
+	intermediate := createIntermediate(t, root)
+	leaf, err := issueLeaf(intermediate, mustKey(t, ECDSAP256), []string{"example.com"}, time.Hour)
+	require.NoError(t, err)
+
+	chains, err := VerifyChain(leaf.Leaf, []*x509.Certificate{intermediate.Cert}, []*x509.Certificate{root.Cert}, "example.com")
+	require.NoError(t, err)
+	require.Len(t, chains[0], 3)
+
+	requireReason := func(err error, reason VerifyReason) {
+		var verifyErr *VerifyError
+		require.True(t, errors.As(err, &verifyErr), err)
+		require.Equal(t, reason, verifyErr.Reason, err.Error())
+	}
+
+	_, err = VerifyChain(leaf.Leaf, []*x509.Certificate{intermediate.Cert}, []*x509.Certificate{root.Cert}, "other.com")
+	requireReason(err, ReasonNameMismatch)
+	require.ErrorContains(t, err, "example.com")
+
+	_, err = VerifyChain(leaf.Leaf, nil, []*x509.Certificate{root.Cert}, "example.com")
+	requireReason(err, ReasonUnknownAuthority)
+
+	expired, err := issueLeaf(intermediate, mustKey(t, ECDSAP256), []string{"example.com"}, -time.Hour)
+	require.NoError(t, err)
+	_, err = VerifyChain(expired.Leaf, []*x509.Certificate{intermediate.Cert}, []*x509.Certificate{root.Cert}, "example.com")
+	requireReason(err, ReasonExpired)
+
+	template := &x509.Certificate{
+		SerialNumber: mustSerial(t),
+		Subject:      pkix.Name{CommonName: "client"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(time.Hour),
+		NotAfter:     time.Now().Add(2 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	future := signTemplate(t, root, template)
+	_, err = VerifyChain(future, nil, []*x509.Certificate{root.Cert}, "example.com")
+	requireReason(err, ReasonNotYetValid)
+
+	template.NotBefore = time.Now().Add(-time.Hour)
+	client := signTemplate(t, root, template)
+	_, err = VerifyChain(client, nil, []*x509.Certificate{root.Cert}, "example.com")
+	requireReason(err, ReasonKeyUsage)
+}
+
+func mustKey(t *testing.T, alg KeyAlgorithm) crypto.Signer {
+	key, err := GenerateKey(alg, 0)
+	require.NoError(t, err)
+	return key
+}
+
+func mustSerial(t *testing.T) *big.Int {
+	serial, err := RandomSerialNumber()
+	require.NoError(t, err)
+	return serial
+}
+
+func signTemplate(t *testing.T, ca *CA, template *x509.Certificate) *x509.Certificate {
+	key := mustKey(t, ECDSAP256)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.Key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func createIntermediate(t *testing.T, root *CA) *CA {
+	key := mustKey(t, ECDSAP256)
+	template := &x509.Certificate{
+		SerialNumber:          mustSerial(t),
+		Subject:               pkix.Name{CommonName: "Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root.Cert, key.Public(), root.Key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &CA{Key: key, Cert: cert}
+}
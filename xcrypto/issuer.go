@@ -0,0 +1,282 @@
+package xcrypto
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	DefaultLeafValidity = time.Hour * 24 * 365
+	DefaultCacheSize    = 1024
+	// renewBefore evicts cached certificates that are about to expire
+	renewBefore = time.Hour
+)
+
+type IssuerOptions struct {
+	// KeyAlgorithm of the leaf keys, defaults to ECDSAP256 which is fast to generate
+	KeyAlgorithm KeyAlgorithm
+	RSABits      int
+	// SharedKey uses a single pooled leaf key for all hosts instead of a fresh key per host,
+	// the pooled key is generated once and is never the key of the CA
+	SharedKey bool
+	// Wildcard issues "*.parent" certificates on demand so sibling hosts share a certificate
+	Wildcard bool
+	// Validity of the leaf certificates, capped to the validity of the CA
+	Validity time.Duration
+	// CacheSize is the maximum number of cached certificates
+	CacheSize int
+}
+
+// CertIssuer issues and caches leaf certificates signed by a CA
+type CertIssuer struct {
+	ca   *CA
+	opts IssuerOptions
+
+	keyOnce   sync.Once
+	sharedKey crypto.Signer
+	keyErr    error
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*issueCall
+}
+
+type cacheEntry struct {
+	key  string
+	cert *tls.Certificate
+}
+
+type issueCall struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+func NewCertIssuer(ca *CA, opts *IssuerOptions) (*CertIssuer, error) {
+	if ca == nil || ca.Key == nil || ca.Cert == nil {
+		return nil, errors.New("xcrypto: issuer requires a CA with key and certificate")
+	}
+	if opts == nil {
+		opts = &IssuerOptions{KeyAlgorithm: ECDSAP256}
+	}
+	i := &CertIssuer{
+		ca:       ca,
+		opts:     *opts,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		inflight: map[string]*issueCall{},
+	}
+	if i.opts.Validity <= 0 {
+		i.opts.Validity = DefaultLeafValidity
+	}
+	if i.opts.CacheSize <= 0 {
+		i.opts.CacheSize = DefaultCacheSize
+	}
+	return i, nil
+}
+
+// Issue returns a certificate for the given DNS names, IP addresses and wildcards,
+// the first name becomes the common name. Certificates are cached by their names.
+func (i *CertIssuer) Issue(names ...string) (*tls.Certificate, error) {
+	if len(names) == 0 {
+		return nil, errors.New("xcrypto: no names to issue a certificate for")
+	}
+	key := cacheKey(names)
+
+	i.mu.Lock()
+	if cert := i.lookup(key); cert != nil {
+		i.mu.Unlock()
+		return cert, nil
+	}
+	if call, ok := i.inflight[key]; ok {
+		i.mu.Unlock()
+		<-call.done
+		return call.cert, call.err
+	}
+	call := &issueCall{done: make(chan struct{})}
+	i.inflight[key] = call
+	i.mu.Unlock()
+
+	// waiters are released even if issuing panics, the panic continues in this goroutine
+	defer func() {
+		e := recover()
+		if e != nil {
+			call.cert, call.err = nil, fmt.Errorf("xcrypto: issuing %v panicked: %v", names, e)
+		}
+		i.mu.Lock()
+		delete(i.inflight, key)
+		if call.err == nil {
+			i.store(key, call.cert)
+		}
+		i.mu.Unlock()
+		close(call.done)
+		if e != nil {
+			panic(e)
+		}
+	}()
+	call.cert, call.err = i.issue(names)
+	return call.cert, call.err
+}
+
+// GetCertificate issues certificates on demand from SNI, to be used as tls.Config.GetCertificate
+func (i *CertIssuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.TrimSuffix(hello.ServerName, ".")
+	if host == "" && hello.Conn != nil {
+		// clients do not send SNI for IP addresses
+		host, _, _ = net.SplitHostPort(hello.Conn.LocalAddr().String())
+	}
+	if host == "" {
+		return nil, errors.New("xcrypto: client hello has no server name")
+	}
+	if i.opts.Wildcard {
+		if wildcard := wildcardOf(host); wildcard != "" {
+			return i.Issue(wildcard, parentOf(host))
+		}
+	}
+	return i.Issue(host)
+}
+
+// Len returns the number of cached certificates
+func (i *CertIssuer) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.lru.Len()
+}
+
+func (i *CertIssuer) lookup(key string) *tls.Certificate {
+	elem, ok := i.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().Add(renewBefore).After(entry.cert.Leaf.NotAfter) {
+		i.lru.Remove(elem)
+		delete(i.entries, key)
+		return nil
+	}
+	i.lru.MoveToFront(elem)
+	return entry.cert
+}
+
+func (i *CertIssuer) store(key string, cert *tls.Certificate) {
+	if elem, ok := i.entries[key]; ok {
+		elem.Value.(*cacheEntry).cert = cert
+		i.lru.MoveToFront(elem)
+		return
+	}
+	i.entries[key] = i.lru.PushFront(&cacheEntry{key: key, cert: cert})
+	for i.lru.Len() > i.opts.CacheSize {
+		oldest := i.lru.Back()
+		i.lru.Remove(oldest)
+		delete(i.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (i *CertIssuer) leafKey() (crypto.Signer, error) {
+	if !i.opts.SharedKey {
+		return GenerateKey(i.opts.KeyAlgorithm, i.opts.RSABits)
+	}
+	i.keyOnce.Do(func() {
+		i.sharedKey, i.keyErr = GenerateKey(i.opts.KeyAlgorithm, i.opts.RSABits)
+	})
+	return i.sharedKey, i.keyErr
+}
+
+func (i *CertIssuer) issue(names []string) (*tls.Certificate, error) {
+	key, err := i.leafKey()
+	if err != nil {
+		return nil, err
+	}
+	return issueLeaf(i.ca, key, names, i.opts.Validity)
+}
+
+// issueLeaf signs a server and client certificate for names with the CA
+func issueLeaf(ca *CA, key crypto.Signer, names []string, validity time.Duration) (*tls.Certificate, error) {
+	serial, err := RandomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-DefaultBackdate)
+	notAfter := time.Now().Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   names[0],
+			Organization: []string{names[0]},
+		},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		// RSA key exchange of TLS 1.0-1.2 encrypts with the certificate key
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate for %v: %v", names, err)
+	}
+	leaf, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{certBytes, ca.Cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func cacheKey(names []string) string {
+	sorted := make([]string, len(names))
+	for n, name := range names {
+		sorted[n] = strings.ToLower(name)
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func parentOf(host string) string {
+	_, parent, _ := strings.Cut(host, ".")
+	return parent
+}
+
+// wildcardOf returns "*.parent" when the parent is at least a registrable domain,
+// "*.co.uk" would cover the hosts of every other registrant
+func wildcardOf(host string) string {
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	parent := strings.ToLower(parentOf(host))
+	if suffix, _ := publicsuffix.PublicSuffix(parent); parent == "" || parent == suffix {
+		return ""
+	}
+	return "*." + parent
+}
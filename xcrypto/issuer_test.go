@@ -0,0 +1,163 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDummyCert(t *testing.T) {
+	key, ca, err := CreateX508Cert()
+	require.NoError(t, err)
+	cert, err := DummyCert(key, ca, "example.com")
+	require.NoError(t, err)
+	require.NotEqual(t, key, cert.PrivateKey)
+	require.Equal(t, []string{"example.com"}, cert.Leaf.DNSNames)
+	require.NoError(t, cert.Leaf.CheckSignatureFrom(ca))
+
+	cert, err = DummyCert(key, ca, "127.0.0.1")
+	require.NoError(t, err)
+	require.Len(t, cert.Leaf.IPAddresses, 1)
+}
+
+func TestCertIssuer(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP256})
+	require.NoError(t, err)
+	issuer, err := NewCertIssuer(ca, &IssuerOptions{CacheSize: 2})
+	require.NoError(t, err)
+
+	a, err := issuer.Issue("a.example.com", "*.b.example.com", "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.example.com", "*.b.example.com"}, a.Leaf.DNSNames)
+	require.True(t, a.Leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")))
+	require.NotEqual(t, ca.Key, a.PrivateKey)
+	require.Equal(t, ca.Cert.Raw, a.Certificate[1])
+
+	cached, err := issuer.Issue("10.0.0.1", "a.example.com", "*.b.example.com")
+	require.NoError(t, err)
+	require.Same(t, a, cached)
+
+	b, err := issuer.Issue("b.example.com")
+	require.NoError(t, err)
+	require.NotEqual(t, a.PrivateKey, b.PrivateKey)
+
+	_, err = issuer.Issue("c.example.com")
+	require.NoError(t, err)
+	require.Equal(t, 2, issuer.Len())
+	again, err := issuer.Issue("a.example.com", "*.b.example.com", "10.0.0.1")
+	require.NoError(t, err)
+	require.NotSame(t, a, again)
+}
+
+func TestCertIssuerSharedKey(t *testing.T) {
+	ca, err := CreateCA(nil)
+	require.NoError(t, err)
+	issuer, err := NewCertIssuer(ca, &IssuerOptions{KeyAlgorithm: RSA, SharedKey: true, Wildcard: true})
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	certs := make([]*tls.Certificate, 8)
+	for n := range certs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			certs[n], _ = issuer.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+		}()
+	}
+	wg.Wait()
+	for _, cert := range certs {
+		require.Same(t, certs[0], cert)
+	}
+	require.Equal(t, []string{"*.example.com", "example.com"}, certs[0].Leaf.DNSNames)
+	require.NotEqual(t, ca.Key, certs[0].PrivateKey)
+	require.NotZero(t, certs[0].Leaf.KeyUsage&x509.KeyUsageKeyEncipherment)
+
+	other, err := issuer.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	require.NoError(t, err)
+	require.Equal(t, certs[0].PrivateKey.(*rsa.PrivateKey), other.PrivateKey.(*rsa.PrivateKey))
+}
+
+func TestWildcardOf(t *testing.T) {
+	for host, want := range map[string]string{
+		"api.example.com":     "*.example.com",
+		"a.b.example.com":     "*.b.example.com",
+		"example.com":         "",
+		"foo.co.uk":           "",
+		"shop.foo.co.uk":      "*.foo.co.uk",
+		"user.github.io":      "",
+		"API.Example.com":     "*.example.com",
+		"10.0.0.1":            "",
+		"host.internal.local": "*.internal.local",
+	} {
+		require.Equal(t, want, wildcardOf(host), host)
+	}
+}
+
+// panicSigner panics when signing after release is closed
+type panicSigner struct {
+	crypto.Signer
+	signing chan struct{}
+	release chan struct{}
+}
+
+func (s *panicSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	close(s.signing)
+	<-s.release
+	panic("hsm unplugged")
+}
+
+func TestCertIssuerPanic(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP256})
+	require.NoError(t, err)
+	signer := &panicSigner{Signer: ca.Key, signing: make(chan struct{}), release: make(chan struct{})}
+	ca.Key = signer
+	issuer, err := NewCertIssuer(ca, nil)
+	require.NoError(t, err)
+
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		issuer.Issue("example.com")
+	}()
+	<-signer.signing
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := issuer.Issue("example.com")
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // the waiter joins the inflight call
+	close(signer.release)
+	require.Equal(t, "hsm unplugged", <-panicked)
+	select {
+	case err := <-waiter:
+		require.ErrorContains(t, err, "panicked")
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter blocked after the panic")
+	}
+	require.Equal(t, 0, issuer.Len())
+}
+
+func TestCertIssuerHandshake(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: Ed25519})
+	require.NoError(t, err)
+	issuer, err := NewCertIssuer(ca, nil)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	go tls.Server(serverConn, &tls.Config{GetCertificate: issuer.GetCertificate}).Handshake()
+	client := tls.Client(clientConn, &tls.Config{ServerName: "secure.example.com", RootCAs: roots})
+	require.NoError(t, client.Handshake())
+	require.Equal(t, "secure.example.com", client.ConnectionState().PeerCertificates[0].Subject.CommonName)
+}
@@ -0,0 +1,252 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+)
+
+// JWK is a JSON web key of RFC 7517, Key holds the parsed public key or the []byte secret of "oct" keys
+type JWK struct {
+	KeyType   string       `json:"kty"`
+	KeyID     string       `json:"kid,omitempty"`
+	Use       string       `json:"use,omitempty"`
+	Algorithm JWTAlgorithm `json:"alg,omitempty"`
+	Curve     string       `json:"crv,omitempty"`
+	N         string       `json:"n,omitempty"`
+	E         string       `json:"e,omitempty"`
+	X         string       `json:"x,omitempty"`
+	Y         string       `json:"y,omitempty"`
+	K         string       `json:"k,omitempty"`
+	Key       any          `json:"-"`
+}
+
+// NewJWK describes a public key or a []byte secret, private keys are reduced to their public key.
+// An empty kid is replaced by the RFC 7638 thumbprint.
+func NewJWK(key any, kid string, alg JWTAlgorithm) (*JWK, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	jwk := &JWK{KeyID: kid, Algorithm: alg, Key: key}
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.X = b64(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = b64(pub)
+	case []byte:
+		jwk.KeyType = "oct"
+		jwk.K = b64(pub)
+	default:
+		return nil, fmt.Errorf("xcrypto: unsupported JWK key %T", key)
+	}
+	if jwk.Use == "" && jwk.KeyType != "oct" {
+		jwk.Use = "sig"
+	}
+	if jwk.KeyID == "" {
+		jwk.KeyID = jwk.Thumbprint()
+	}
+	return jwk, nil
+}
+
+// Thumbprint returns the base64url SHA-256 thumbprint of RFC 7638
+func (k *JWK) Thumbprint() string {
+	var canonical string
+	switch k.KeyType {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Curve, k.X, k.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Curve, k.X)
+	default:
+		canonical = fmt.Sprintf(`{"k":%q,"kty":%q}`, k.K, k.KeyType)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+// parse fills Key from the JSON members
+func (k *JWK) parse() error {
+	decode := func(name, value string) ([]byte, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("xcrypto: JWK %q has an invalid %s", k.KeyID, name)
+		}
+		return data, nil
+	}
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode("n", k.N)
+		if err != nil {
+			return err
+		}
+		e, err := decode("e", k.E)
+		if err != nil {
+			return err
+		}
+		if len(e) > 4 {
+			return fmt.Errorf("xcrypto: JWK %q has an invalid e", k.KeyID)
+		}
+		k.Key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return fmt.Errorf("xcrypto: JWK %q has an unsupported curve %q", k.KeyID, k.Curve)
+		}
+		x, err := decode("x", k.X)
+		if err != nil {
+			return err
+		}
+		y, err := decode("y", k.Y)
+		if err != nil {
+			return err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return fmt.Errorf("xcrypto: JWK %q is not on curve %s", k.KeyID, k.Curve)
+		}
+		k.Key = pub
+	case "OKP":
+		x, err := decode("x", k.X)
+		if err != nil {
+			return err
+		}
+		if k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return fmt.Errorf("xcrypto: JWK %q has an unsupported curve %q", k.KeyID, k.Curve)
+		}
+		k.Key = ed25519.PublicKey(x)
+	case "oct":
+		secret, err := decode("k", k.K)
+		if err != nil {
+			return err
+		}
+		k.Key = secret
+	default:
+		return fmt.Errorf("xcrypto: unsupported JWK key type %q", k.KeyType)
+	}
+	return nil
+}
+
+// JWKSet is a JWKS document, it can be served as http.Handler
+type JWKSet struct {
+	mu   sync.RWMutex
+	keys []*JWK
+}
+
+func NewJWKSet(keys ...*JWK) *JWKSet {
+	return &JWKSet{keys: keys}
+}
+
+// ParseJWKSet parses a JWKS document, keys of unsupported types are skipped
+func ParseJWKSet(data []byte) (*JWKSet, error) {
+	var doc struct {
+		Keys []*JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	set := &JWKSet{}
+	for _, key := range doc.Keys {
+		if err := key.parse(); err != nil {
+			continue
+		}
+		set.keys = append(set.keys, key)
+	}
+	if len(set.keys) == 0 {
+		return nil, errors.New("xcrypto: JWKS has no supported keys")
+	}
+	return set, nil
+}
+
+// Add adds a key, see NewJWK
+func (s *JWKSet) Add(key any, kid string, alg JWTAlgorithm) (*JWK, error) {
+	jwk, err := NewJWK(key, kid, alg)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, jwk)
+	return jwk, nil
+}
+
+// Remove removes the key with kid, e.g. after a rotation
+func (s *JWKSet) Remove(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, key := range s.keys {
+		if key.KeyID == kid {
+			s.keys = append(s.keys[:i:i], s.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Lookup returns the key with kid, an empty kid matches when the set has a single key
+func (s *JWKSet) Lookup(kid string) (*JWK, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid == "" {
+		if len(s.keys) == 1 {
+			return s.keys[0], true
+		}
+		return nil, false
+	}
+	for _, key := range s.keys {
+		if key.KeyID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (s *JWKSet) Keys() []*JWK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*JWK{}, s.keys...)
+}
+
+// MarshalJSON encodes all keys, including "oct" secrets
+func (s *JWKSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string][]*JWK{"keys": s.Keys()})
+}
+
+// ServeHTTP serves the public keys, "oct" secrets are never published
+func (s *JWKSet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	public := []*JWK{}
+	for _, key := range s.Keys() {
+		if key.KeyType != "oct" {
+			public = append(public, key)
+		}
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string][]*JWK{"keys": public})
+}
@@ -0,0 +1,506 @@
+package xcrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xcast"
+)
+
+// JWTAlgorithm is the "alg" header of a JWS
+type JWTAlgorithm string
+
+const (
+	HS256 JWTAlgorithm = "HS256"
+	HS384 JWTAlgorithm = "HS384"
+	HS512 JWTAlgorithm = "HS512"
+	RS256 JWTAlgorithm = "RS256"
+	PS256 JWTAlgorithm = "PS256"
+	ES256 JWTAlgorithm = "ES256"
+	ES384 JWTAlgorithm = "ES384"
+	EdDSA JWTAlgorithm = "EdDSA"
+	// JWTNone is an unsigned token, it is only accepted with JWTVerifier.AllowNone
+	JWTNone JWTAlgorithm = "none"
+)
+
+// JWTAlgorithms are the algorithms accepted by default
+var JWTAlgorithms = []JWTAlgorithm{HS256, HS384, HS512, RS256, PS256, ES256, ES384, EdDSA}
+
+var (
+	ErrJWTMalformed   = errors.New("xcrypto: malformed token")
+	ErrJWTAlgorithm   = errors.New("xcrypto: token algorithm is not allowed")
+	ErrJWTSignature   = errors.New("xcrypto: token signature is invalid")
+	ErrJWTKeyNotFound = errors.New("xcrypto: token key not found")
+	ErrJWTExpired     = errors.New("xcrypto: token is expired")
+	ErrJWTNotYetValid = errors.New("xcrypto: token is not valid yet")
+	ErrJWTIssuedAt    = errors.New("xcrypto: token is issued in the future")
+	ErrJWTIssuer      = errors.New("xcrypto: token issuer is not accepted")
+	ErrJWTAudience    = errors.New("xcrypto: token audience is not accepted")
+)
+
+type JWTHeader struct {
+	Algorithm JWTAlgorithm `json:"alg"`
+	Type      string       `json:"typ,omitempty"`
+	KeyID     string       `json:"kid,omitempty"`
+	Critical  []string     `json:"crit,omitempty"`
+}
+
+// JWT is a verified token, Claims keeps numbers as json.Number
+type JWT struct {
+	Header JWTHeader
+	Claims map[string]any
+	Raw    string
+}
+
+// DecodeClaims returns the claims as T, e.g. a struct with json tags
+func DecodeClaims[T any](t *JWT) (T, error) {
+	return xcast.ToAnyE[T](t.Claims)
+}
+
+func (t *JWT) Issuer() string {
+	return xcast.ToString(t.Claims["iss"])
+}
+
+func (t *JWT) Subject() string {
+	return xcast.ToString(t.Claims["sub"])
+}
+
+func (t *JWT) ID() string {
+	return xcast.ToString(t.Claims["jti"])
+}
+
+// Audience returns the "aud" claim, a single string or a list
+func (t *JWT) Audience() []string {
+	switch aud := t.Claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		audience := make([]string, 0, len(aud))
+		for _, a := range aud {
+			audience = append(audience, xcast.ToString(a))
+		}
+		return audience
+	default:
+		return nil
+	}
+}
+
+func (t *JWT) ExpiresAt() (time.Time, bool) {
+	return t.numericDate("exp")
+}
+
+func (t *JWT) NotBefore() (time.Time, bool) {
+	return t.numericDate("nbf")
+}
+
+func (t *JWT) IssuedAt() (time.Time, bool) {
+	return t.numericDate("iat")
+}
+
+// maxNumericDate bounds NumericDate claims so that they fit a time.Time in nanoseconds
+const maxNumericDate = float64(1<<62) / 1e9
+
+func (t *JWT) numericDate(name string) (time.Time, bool) {
+	value, ok := t.Claims[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	var seconds float64
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	case float64:
+		seconds = v
+	case int:
+		seconds = float64(v)
+	case int64:
+		seconds = float64(v)
+	default:
+		return time.Time{}, false
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) || math.Abs(seconds) > maxNumericDate {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// SignJWT signs claims, a struct or map, with key.
+// HS algorithms take a []byte key, the others a private key of the matching type.
+func SignJWT(claims any, alg JWTAlgorithm, key any, kid string) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return SignJWS(payload, JWTHeader{Algorithm: alg, Type: "JWT", KeyID: kid}, key)
+}
+
+// SignJWS signs payload with the compact serialization
+func SignJWS(payload []byte, header JWTHeader, key any) (string, error) {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64(headerJSON) + "." + b64(payload)
+	signature, err := signJWS(header.Algorithm, key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64(signature), nil
+}
+
+// JWTVerifier verifies signatures and registered claims of tokens
+type JWTVerifier struct {
+	// Key is a []byte secret or a public key, KeySet selects keys by "kid"
+	Key        any
+	KeySet     *JWKSet
+	Algorithms []JWTAlgorithm
+	AllowNone  bool
+	Issuer     string
+	Audience   string
+	// Leeway tolerates clock skew for exp, nbf and iat
+	Leeway        time.Duration
+	RequireExpiry bool
+	Now           func() time.Time
+}
+
+// NewJWTVerifier verifies with key and requires an "exp" claim
+func NewJWTVerifier(key any) *JWTVerifier {
+	return &JWTVerifier{Key: key, Algorithms: JWTAlgorithms, RequireExpiry: true, Now: time.Now}
+}
+
+// NewJWKSVerifier verifies with the key of a JWKS selected by "kid"
+func NewJWKSVerifier(keySet *JWKSet) *JWTVerifier {
+	return NewJWTVerifier(nil).SetKeySet(keySet)
+}
+
+func (v *JWTVerifier) SetKeySet(keySet *JWKSet) *JWTVerifier {
+	v.KeySet = keySet
+	return v
+}
+
+func (v *JWTVerifier) SetAlgorithms(algs ...JWTAlgorithm) *JWTVerifier {
+	v.Algorithms = algs
+	return v
+}
+
+func (v *JWTVerifier) SetAllowNone(allowNone bool) *JWTVerifier {
+	v.AllowNone = allowNone
+	return v
+}
+
+func (v *JWTVerifier) SetIssuer(issuer string) *JWTVerifier {
+	v.Issuer = issuer
+	return v
+}
+
+func (v *JWTVerifier) SetAudience(audience string) *JWTVerifier {
+	v.Audience = audience
+	return v
+}
+
+func (v *JWTVerifier) SetLeeway(leeway time.Duration) *JWTVerifier {
+	v.Leeway = leeway
+	return v
+}
+
+func (v *JWTVerifier) SetRequireExpiry(requireExpiry bool) *JWTVerifier {
+	v.RequireExpiry = requireExpiry
+	return v
+}
+
+// Verify checks the signature and the registered claims, a "Bearer " prefix is ignored
+func (v *JWTVerifier) Verify(token string) (*JWT, error) {
+	token = trimBearer(token)
+	header, payload, err := v.VerifySignature(token)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	claims := map[string]any{}
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWTMalformed, err)
+	}
+	jwt := &JWT{Header: *header, Claims: claims, Raw: token}
+	if err := v.validate(jwt); err != nil {
+		return nil, err
+	}
+	return jwt, nil
+}
+
+// VerifySignature checks the signature of a compact JWS and returns its payload
+func (v *JWTVerifier) VerifySignature(token string) (*JWTHeader, []byte, error) {
+	token = trimBearer(token)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, ErrJWTMalformed
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+	header := &JWTHeader{}
+	if err := json.Unmarshal(headerJSON, header); err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+	if len(header.Critical) > 0 {
+		return nil, nil, fmt.Errorf("%w: unsupported critical headers %v", ErrJWTMalformed, header.Critical)
+	}
+	if header.Algorithm == JWTNone {
+		if !v.AllowNone || len(signature) > 0 {
+			return nil, nil, ErrJWTAlgorithm
+		}
+		return header, payload, nil
+	}
+	algs := v.Algorithms
+	if algs == nil {
+		algs = JWTAlgorithms
+	}
+	if !slices.Contains(algs, header.Algorithm) {
+		return nil, nil, fmt.Errorf("%w: %q", ErrJWTAlgorithm, header.Algorithm)
+	}
+	key, err := v.key(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	signingInput := token[:len(parts[0])+1+len(parts[1])]
+	if err := verifyJWS(header.Algorithm, key, []byte(signingInput), signature); err != nil {
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
+
+func (v *JWTVerifier) key(header *JWTHeader) (any, error) {
+	if v.KeySet == nil {
+		if v.Key == nil {
+			return nil, ErrJWTKeyNotFound
+		}
+		return v.Key, nil
+	}
+	jwk, ok := v.KeySet.Lookup(header.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrJWTKeyNotFound, header.KeyID)
+	}
+	if jwk.Algorithm != "" && jwk.Algorithm != header.Algorithm {
+		return nil, fmt.Errorf("%w: key %q is for %s", ErrJWTAlgorithm, jwk.KeyID, jwk.Algorithm)
+	}
+	return jwk.Key, nil
+}
+
+func (v *JWTVerifier) validate(t *JWT) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		if _, ok := t.Claims[name]; ok {
+			if _, valid := t.numericDate(name); !valid {
+				return fmt.Errorf("%w: %s is not a number", ErrJWTMalformed, name)
+			}
+		}
+	}
+	if exp, ok := t.ExpiresAt(); ok {
+		if !now.Before(exp.Add(v.Leeway)) {
+			return ErrJWTExpired
+		}
+	} else if v.RequireExpiry {
+		return fmt.Errorf("%w: missing exp", ErrJWTExpired)
+	}
+	if nbf, ok := t.NotBefore(); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrJWTNotYetValid
+	}
+	if iat, ok := t.IssuedAt(); ok && now.Add(v.Leeway).Before(iat) {
+		return ErrJWTIssuedAt
+	}
+	if v.Issuer != "" && t.Issuer() != v.Issuer {
+		return fmt.Errorf("%w: %q", ErrJWTIssuer, t.Issuer())
+	}
+	if v.Audience != "" && !slices.Contains(t.Audience(), v.Audience) {
+		return fmt.Errorf("%w: %v", ErrJWTAudience, t.Audience())
+	}
+	return nil
+}
+
+func jwsHash(alg JWTAlgorithm) crypto.Hash {
+	switch alg {
+	case HS384, ES384:
+		return crypto.SHA384
+	case HS512:
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+func signJWS(alg JWTAlgorithm, key any, signingInput []byte) ([]byte, error) {
+	if alg == JWTNone {
+		return nil, nil
+	}
+	if alg == HS256 || alg == HS384 || alg == HS512 {
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return nil, fmt.Errorf("xcrypto: %s requires a []byte key", alg)
+		}
+		mac := hmac.New(jwsHash(alg).New, secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("xcrypto: %s requires a private key, got %T", alg, key)
+	}
+	if err := checkJWSKey(alg, signer.Public()); err != nil {
+		return nil, err
+	}
+	if alg == EdDSA {
+		return signer.Sign(rand.Reader, signingInput, crypto.Hash(0))
+	}
+	hash := jwsHash(alg)
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+	switch alg {
+	case RS256:
+		return signer.Sign(rand.Reader, digest, hash)
+	case PS256:
+		return signer.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	default:
+		der, err := signer.Sign(rand.Reader, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed size r || s encoding instead of ASN.1
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			return nil, err
+		}
+		size := (signer.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+		out := make([]byte, 2*size)
+		sig.R.FillBytes(out[:size])
+		sig.S.FillBytes(out[size:])
+		return out, nil
+	}
+}
+
+func verifyJWS(alg JWTAlgorithm, key any, signingInput, signature []byte) error {
+	if alg == HS256 || alg == HS384 || alg == HS512 {
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return fmt.Errorf("%w: %s requires a []byte key", ErrJWTAlgorithm, alg)
+		}
+		mac := hmac.New(jwsHash(alg).New, secret)
+		mac.Write(signingInput)
+		if subtle.ConstantTimeCompare(mac.Sum(nil), signature) != 1 {
+			return ErrJWTSignature
+		}
+		return nil
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	if err := checkJWSKey(alg, key); err != nil {
+		return fmt.Errorf("%w: %v", ErrJWTAlgorithm, err)
+	}
+	if alg == EdDSA {
+		if !ed25519.Verify(key.(ed25519.PublicKey), signingInput, signature) {
+			return ErrJWTSignature
+		}
+		return nil
+	}
+	hash := jwsHash(alg)
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+	var err error
+	switch alg {
+	case RS256:
+		err = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), hash, digest, signature)
+	case PS256:
+		err = rsa.VerifyPSS(key.(*rsa.PublicKey), hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	default:
+		pub := key.(*ecdsa.PublicKey)
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrJWTSignature
+		}
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrJWTSignature
+		}
+	}
+	if err != nil {
+		return ErrJWTSignature
+	}
+	return nil
+}
+
+// checkJWSKey rejects keys that do not belong to the algorithm, e.g. an RSA key used as HMAC secret
+func checkJWSKey(alg JWTAlgorithm, key crypto.PublicKey) error {
+	switch alg {
+	case RS256, PS256:
+		if pub, ok := key.(*rsa.PublicKey); ok {
+			if pub.N.BitLen() < 2048 {
+				return fmt.Errorf("xcrypto: %s requires an RSA key of at least 2048 bits", alg)
+			}
+			return nil
+		}
+	case ES256, ES384:
+		curve := elliptic.P256()
+		if alg == ES384 {
+			curve = elliptic.P384()
+		}
+		if pub, ok := key.(*ecdsa.PublicKey); ok && pub.Curve == curve {
+			return nil
+		}
+	case EdDSA:
+		if _, ok := key.(ed25519.PublicKey); ok {
+			return nil
+		}
+	default:
+		return fmt.Errorf("xcrypto: unsupported algorithm %q", alg)
+	}
+	return fmt.Errorf("xcrypto: %s does not accept %T keys", alg, key)
+}
+
+func trimBearer(token string) string {
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,210 @@
+package xcrypto
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTRoundTrip(t *testing.T) {
+	type claims struct {
+		Subject string   `json:"sub"`
+		Roles   []string `json:"roles"`
+		Expires int64    `json:"exp"`
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	keys := map[JWTAlgorithm]any{
+		HS256: []byte("secret"), HS384: []byte("secret"), HS512: []byte("secret"),
+		RS256: mustKey(t, RSA), PS256: mustKey(t, RSA),
+		ES256: mustKey(t, ECDSAP256), ES384: mustKey(t, ECDSAP384), EdDSA: mustKey(t, Ed25519),
+	}
+	for alg, key := range keys {
+		token, err := SignJWT(claims{Subject: "alice", Roles: []string{"admin"}, Expires: exp}, alg, key, "k1")
+		require.NoError(t, err, alg)
+		jwt, err := NewJWTVerifier(key).Verify("Bearer " + token)
+		require.NoError(t, err, alg)
+		require.Equal(t, alg, jwt.Header.Algorithm)
+		require.Equal(t, "k1", jwt.Header.KeyID)
+		require.Equal(t, "alice", jwt.Subject())
+		decoded, err := DecodeClaims[claims](jwt)
+		require.NoError(t, err)
+		require.Equal(t, claims{Subject: "alice", Roles: []string{"admin"}, Expires: exp}, decoded)
+
+		// a flipped signature bit or another algorithm is rejected
+		parts := strings.Split(token, ".")
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		signature[0] ^= 1
+		_, err = NewJWTVerifier(key).Verify(parts[0] + "." + parts[1] + "." + b64(signature))
+		require.ErrorIs(t, err, ErrJWTSignature, alg)
+		_, err = NewJWTVerifier(key).SetAlgorithms(HS256, ES256).Verify(token)
+		if alg != HS256 && alg != ES256 {
+			require.ErrorIs(t, err, ErrJWTAlgorithm, alg)
+		}
+	}
+
+	// an RSA public key must not be usable as HMAC secret
+	rsaKey := mustKey(t, RSA)
+	pem, err := EncodePublicKey(rsaKey.Public(), PEM)
+	require.NoError(t, err)
+	forged, err := SignJWT(map[string]any{"exp": exp}, HS256, pem, "")
+	require.NoError(t, err)
+	_, err = NewJWTVerifier(rsaKey.Public()).Verify(forged)
+	require.ErrorIs(t, err, ErrJWTAlgorithm)
+	_, err = SignJWT(map[string]any{}, ES384, mustKey(t, ECDSAP256), "")
+	require.Error(t, err)
+}
+
+func TestJWTNone(t *testing.T) {
+	token, err := SignJWT(map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}, JWTNone, nil, "")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(token, "."))
+	_, err = NewJWTVerifier([]byte("secret")).Verify(token)
+	require.ErrorIs(t, err, ErrJWTAlgorithm)
+	jwt, err := NewJWTVerifier(nil).SetAllowNone(true).Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "alice", jwt.Subject())
+}
+
+func TestJWTClaims(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	verifier := NewJWTVerifier(key).SetIssuer("https://issuer").SetAudience("api").SetLeeway(time.Minute)
+	verifier.Now = func() time.Time { return now }
+	verify := func(claims map[string]any) error {
+		token, err := SignJWT(claims, HS256, key, "")
+		require.NoError(t, err)
+		_, err = verifier.Verify(token)
+		return err
+	}
+	valid := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{"iss": "https://issuer", "aud": []string{"web", "api"}, "exp": now.Unix() + 60, "iat": now.Unix(), "nbf": now.Unix()}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	require.NoError(t, verify(valid(nil)))
+	require.NoError(t, verify(valid(map[string]any{"aud": "api", "exp": now.Unix() - 30, "nbf": now.Unix() + 30, "iat": 1.7e9 + 30.5})))
+	require.ErrorIs(t, verify(valid(map[string]any{"exp": now.Unix() - 60})), ErrJWTExpired)
+	require.ErrorIs(t, verify(valid(map[string]any{"exp": nil})), ErrJWTExpired)
+	require.ErrorIs(t, verify(valid(map[string]any{"exp": "tomorrow"})), ErrJWTMalformed)
+	require.ErrorIs(t, verify(valid(map[string]any{"exp": strconv.FormatInt(now.Unix()+60, 10)})), ErrJWTMalformed)
+	require.ErrorIs(t, verify(valid(map[string]any{"exp": 1e300})), ErrJWTMalformed)
+	require.ErrorIs(t, verify(valid(map[string]any{"nbf": 1e300})), ErrJWTMalformed)
+	require.ErrorIs(t, verify(valid(map[string]any{"nbf": 9.3e9})), ErrJWTMalformed)
+	require.ErrorIs(t, verify(valid(map[string]any{"nbf": 4e9})), ErrJWTNotYetValid)
+	require.ErrorIs(t, verify(valid(map[string]any{"nbf": now.Unix() + 120})), ErrJWTNotYetValid)
+	require.ErrorIs(t, verify(valid(map[string]any{"iat": now.Unix() + 120})), ErrJWTIssuedAt)
+	require.ErrorIs(t, verify(valid(map[string]any{"iss": "https://other"})), ErrJWTIssuer)
+	require.ErrorIs(t, verify(valid(map[string]any{"aud": "web"})), ErrJWTAudience)
+
+	verifier.SetRequireExpiry(false)
+	require.NoError(t, verify(valid(map[string]any{"exp": nil})))
+	_, err := verifier.Verify("a.b")
+	require.ErrorIs(t, err, ErrJWTMalformed)
+}
+
+// RFC 7515 appendix A.1
+func TestJWSVectorHS256(t *testing.T) {
+	token := "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9" +
+		".eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ" +
+		".dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	keySet, err := ParseJWKSet([]byte(`{"keys":[{"kty":"oct","k":"AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"}]}`))
+	require.NoError(t, err)
+	verifier := NewJWKSVerifier(keySet).SetIssuer("joe")
+	verifier.Now = func() time.Time { return time.Unix(1300819000, 0) }
+	jwt, err := verifier.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, true, jwt.Claims["http://example.com/is_root"])
+	verifier.Now = time.Now
+	_, err = verifier.Verify(token)
+	require.ErrorIs(t, err, ErrJWTExpired)
+}
+
+// RFC 8037 appendix A
+func TestJWSVectorEdDSA(t *testing.T) {
+	d, err := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	require.NoError(t, err)
+	key := ed25519.NewKeyFromSeed(d)
+	jwk, err := NewJWK(key, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", jwk.X)
+	require.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", jwk.KeyID)
+
+	const expected = "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc" +
+		".hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+	token, err := SignJWS([]byte("Example of Ed25519 signing"), JWTHeader{Algorithm: EdDSA}, key)
+	require.NoError(t, err)
+	require.Equal(t, expected, token)
+	_, payload, err := NewJWTVerifier(key.Public()).VerifySignature(expected)
+	require.NoError(t, err)
+	require.Equal(t, "Example of Ed25519 signing", string(payload))
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, ecKey, edKey := mustKey(t, RSA), mustKey(t, ECDSAP384), mustKey(t, Ed25519)
+	keySet := NewJWKSet()
+	_, err := keySet.Add(rsaKey, "rsa", RS256)
+	require.NoError(t, err)
+	_, err = keySet.Add(ecKey, "ec", ES384)
+	require.NoError(t, err)
+	ed, err := keySet.Add(edKey, "", EdDSA)
+	require.NoError(t, err)
+	_, err = keySet.Add([]byte("secret"), "hmac", HS256)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(keySet)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "application/jwk-set+json", resp.Header.Get("Content-Type"))
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "hmac")
+	published, err := ParseJWKSet(data)
+	require.NoError(t, err)
+	require.Len(t, published.Keys(), 3)
+
+	verifier := NewJWKSVerifier(published)
+	claims := map[string]any{"exp": time.Now().Add(time.Minute).Unix()}
+	for kid, signer := range map[string]struct {
+		alg JWTAlgorithm
+		key any
+	}{"rsa": {RS256, rsaKey}, "ec": {ES384, ecKey}, ed.KeyID: {EdDSA, edKey}} {
+		token, err := SignJWT(claims, signer.alg, signer.key, kid)
+		require.NoError(t, err)
+		_, err = verifier.Verify(token)
+		require.NoError(t, err, kid)
+	}
+	token, err := SignJWT(claims, RS256, rsaKey, "unknown")
+	require.NoError(t, err)
+	_, err = verifier.Verify(token)
+	require.ErrorIs(t, err, ErrJWTKeyNotFound)
+	token, err = SignJWT(claims, PS256, rsaKey, "rsa")
+	require.NoError(t, err)
+	_, err = verifier.Verify(token)
+	require.ErrorIs(t, err, ErrJWTAlgorithm)
+
+	all, err := json.Marshal(keySet)
+	require.NoError(t, err)
+	require.Contains(t, string(all), "hmac")
+	keySet.Remove("hmac")
+	require.Len(t, keySet.Keys(), 3)
+	_, err = ParseJWKSet([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AA","y":"AA"}]}`))
+	require.Error(t, err)
+}
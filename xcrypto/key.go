@@ -0,0 +1,81 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+)
+
+type KeyAlgorithm int
+
+const (
+	RSA KeyAlgorithm = iota
+	ECDSAP256
+	ECDSAP384
+	Ed25519
+)
+
+const DefaultRSABits = 2048
+
+func (a KeyAlgorithm) String() string {
+	switch a {
+	case RSA:
+		return "RSA"
+	case ECDSAP256:
+		return "ECDSA-P256"
+	case ECDSAP384:
+		return "ECDSA-P384"
+	case Ed25519:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("KeyAlgorithm(%d)", int(a))
+	}
+}
+
+// GenerateKey creates a private key, rsaBits is only used for RSA and defaults to 2048
+func GenerateKey(alg KeyAlgorithm, rsaBits int) (crypto.Signer, error) {
+	switch alg {
+	case RSA:
+		if rsaBits <= 0 {
+			rsaBits = DefaultRSABits
+		}
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm: %v", alg)
+	}
+}
+
+// RandomSerialNumber returns a positive random 128 bit certificate serial number
+func RandomSerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	for {
+		serial, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial number: %v", err)
+		}
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
+
+// PublicKeyEqual reports whether both public keys are the same
+func PublicKeyEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
@@ -0,0 +1,281 @@
+package xcrypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMasterKeyEnv holds a base64 or hex master key for SecretFromEnv
+const DefaultMasterKeyEnv = "XCRYPTO_MASTER_KEY"
+
+var (
+	keyringMagic = []byte("xck\x01")
+	keyringAD    = []byte("xcrypto keyring")
+
+	ErrUnknownKey   = errors.New("xcrypto: unknown keyring key")
+	ErrKeyringEmpty = errors.New("xcrypto: keyring has no keys, use NewKeyring or LoadKeyring")
+)
+
+// Keyring holds versioned data encryption keys wrapped by a master key.
+// Data is encrypted with the newest key, ciphertexts record the ID of their key.
+type Keyring struct {
+	mu     sync.RWMutex
+	master []byte
+	keys   []keyringKey
+}
+
+type keyringKey struct {
+	ID      uint32    `json:"id"`
+	Created time.Time `json:"created"`
+	Wrapped []byte    `json:"wrapped"`
+}
+
+type keyringFile struct {
+	Master []byte       `json:"master"`
+	Keys   []keyringKey `json:"keys"`
+}
+
+// NewKeyring creates a keyring with a random master key and one data key
+func NewKeyring() (*Keyring, error) {
+	master, err := NewRandomKey()
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{master: master}
+	if _, err := k.Rotate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Rotate adds a new data key and makes it active
+func (k *Keyring) Rotate() (uint32, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.master) != KeySize {
+		return 0, ErrKeyringEmpty
+	}
+	id := uint32(1)
+	if len(k.keys) > 0 {
+		if k.keys[len(k.keys)-1].ID == math.MaxUint32 {
+			return 0, errors.New("xcrypto: keyring key IDs are exhausted")
+		}
+		id = k.keys[len(k.keys)-1].ID + 1
+	}
+	dek, err := NewRandomKey()
+	if err != nil {
+		return 0, err
+	}
+	wrapped, err := Seal(RawKey(k.master), AES256GCM, dek, wrapAD(id))
+	if err != nil {
+		return 0, err
+	}
+	k.keys = append(k.keys, keyringKey{ID: id, Created: time.Now().UTC(), Wrapped: wrapped})
+	return id, nil
+}
+
+// ActiveID returns the ID of the key used by Encrypt
+func (k *Keyring) ActiveID() (uint32, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.activeID()
+}
+
+func (k *Keyring) activeID() (uint32, error) {
+	if len(k.keys) == 0 {
+		return 0, ErrKeyringEmpty
+	}
+	return k.keys[len(k.keys)-1].ID, nil
+}
+
+func (k *Keyring) IDs() []uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]uint32, len(k.keys))
+	for i, key := range k.keys {
+		ids[i] = key.ID
+	}
+	return ids
+}
+
+// Remove retires an old key, data encrypted with it can no longer be decrypted
+func (k *Keyring) Remove(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	i := slices.IndexFunc(k.keys, func(key keyringKey) bool { return key.ID == id })
+	if i < 0 {
+		return ErrUnknownKey
+	}
+	if i == len(k.keys)-1 {
+		return errors.New("xcrypto: the active key cannot be removed")
+	}
+	k.keys = slices.Delete(k.keys, i, i+1)
+	return nil
+}
+
+// Encrypt seals plaintext with the active key, additionalData is authenticated but not encrypted
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	id, err := k.activeID()
+	if err != nil {
+		return nil, err
+	}
+	dek, err := k.dataKey(id)
+	if err != nil {
+		return nil, err
+	}
+	prefix := keyringPrefix(id)
+	envelope, err := Seal(RawKey(dek), AES256GCM, plaintext, concat(prefix, additionalData))
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, envelope...), nil
+}
+
+// Decrypt opens data of Encrypt with the key it was encrypted with
+func (k *Keyring) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	id, err := KeyringKeyID(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	dek, err := k.dataKey(id)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ciphertext[:len(keyringMagic)+4]
+	return Open(RawKey(dek), ciphertext[len(prefix):], concat(prefix, additionalData))
+}
+
+// Reencrypt moves a ciphertext to the active key, it is returned unchanged when already encrypted with it
+func (k *Keyring) Reencrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	id, err := KeyringKeyID(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	active, err := k.ActiveID()
+	if err != nil {
+		return nil, err
+	}
+	if id == active {
+		return ciphertext, nil
+	}
+	plaintext, err := k.Decrypt(ciphertext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return k.Encrypt(plaintext, additionalData)
+}
+
+// KeyringKeyID returns the ID of the key a ciphertext was encrypted with
+func KeyringKeyID(ciphertext []byte) (uint32, error) {
+	if len(ciphertext) < len(keyringMagic)+4 || !bytes.HasPrefix(ciphertext, keyringMagic) {
+		return 0, ErrInvalidEnvelope
+	}
+	return binary.BigEndian.Uint32(ciphertext[len(keyringMagic):]), nil
+}
+
+func (k *Keyring) dataKey(id uint32) ([]byte, error) {
+	i := slices.IndexFunc(k.keys, func(key keyringKey) bool { return key.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("%w %d", ErrUnknownKey, id)
+	}
+	return Open(RawKey(k.master), k.keys[i].Wrapped, wrapAD(id))
+}
+
+func keyringPrefix(id uint32) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, keyringMagic...), id)
+}
+
+func wrapAD(id uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte("xcrypto keyring key "), id)
+}
+
+// Save writes the keyring encrypted with secret, a passphrase or a raw master key
+func (k *Keyring) Save(path string, secret Secret) error {
+	k.mu.RLock()
+	data, err := json.Marshal(keyringFile{Master: k.master, Keys: k.keys})
+	k.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	envelope, err := Seal(secret, AES256GCM, data, keyringAD)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, envelope, 0600)
+}
+
+func LoadKeyring(path string, secret Secret) (*Keyring, error) {
+	envelope, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := Open(secret, envelope, keyringAD)
+	if err != nil {
+		return nil, fmt.Errorf("xcrypto: keyring %s: %w", path, err)
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Master) != KeySize || len(file.Keys) == 0 {
+		return nil, fmt.Errorf("xcrypto: keyring %s is invalid", path)
+	}
+	// IDs must be unique and increasing, the last key is the active one
+	for i, key := range file.Keys {
+		if key.ID == 0 || i > 0 && key.ID <= file.Keys[i-1].ID {
+			return nil, fmt.Errorf("xcrypto: keyring %s has out of order key ID %d", path, key.ID)
+		}
+	}
+	return &Keyring{master: file.Master, keys: file.Keys}, nil
+}
+
+// LoadOrCreateKeyring loads the keyring or creates and saves a new one when path does not exist
+func LoadOrCreateKeyring(path string, secret Secret) (*Keyring, error) {
+	k, err := LoadKeyring(path, secret)
+	if !os.IsNotExist(err) {
+		return k, err
+	}
+	k, err = NewKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.Save(path, secret); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SecretFromEnv reads a base64 or hex encoded key of KeySize bytes from an environment variable
+func SecretFromEnv(name string) (Secret, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return Secret{}, fmt.Errorf("xcrypto: environment variable %s is not set", name)
+	}
+	for _, decode := range []func(string) ([]byte, error){
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+	} {
+		if key, err := decode(value); err == nil && len(key) == KeySize {
+			return RawKey(key), nil
+		}
+	}
+	return Secret{}, fmt.Errorf("xcrypto: %s must hold a base64 or hex key of %d bytes", name, KeySize)
+}
@@ -0,0 +1,126 @@
+package xcrypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring(t *testing.T) {
+	k, err := NewKeyring()
+	require.NoError(t, err)
+	active, err := k.ActiveID()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), active)
+
+	old, err := k.Encrypt([]byte("token"), []byte("user:1"))
+	require.NoError(t, err)
+	id, err := k.Rotate()
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), id)
+	require.Equal(t, []uint32{1, 2}, k.IDs())
+
+	plaintext, err := k.Decrypt(old, []byte("user:1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("token"), plaintext)
+	_, err = k.Decrypt(old, []byte("user:2"))
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	// the key ID is authenticated
+	forged := append([]byte{}, old...)
+	forged[len(keyringMagic)+3] = 2
+	_, err = k.Decrypt(forged, []byte("user:1"))
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	current, err := k.Reencrypt(old, []byte("user:1"))
+	require.NoError(t, err)
+	id, err = KeyringKeyID(current)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), id)
+	same, err := k.Reencrypt(current, []byte("user:1"))
+	require.NoError(t, err)
+	require.Equal(t, current, same)
+
+	require.Error(t, k.Remove(2))
+	require.NoError(t, k.Remove(1))
+	require.ErrorIs(t, k.Remove(1), ErrUnknownKey)
+	_, err = k.Decrypt(old, []byte("user:1"))
+	require.ErrorIs(t, err, ErrUnknownKey)
+	plaintext, err = k.Decrypt(current, []byte("user:1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("token"), plaintext)
+	_, err = KeyringKeyID([]byte("xx"))
+	require.ErrorIs(t, err, ErrInvalidEnvelope)
+}
+
+func TestKeyringEmpty(t *testing.T) {
+	var k Keyring
+	_, err := k.ActiveID()
+	require.ErrorIs(t, err, ErrKeyringEmpty)
+	_, err = k.Encrypt([]byte("token"), nil)
+	require.ErrorIs(t, err, ErrKeyringEmpty)
+	_, err = k.Rotate()
+	require.ErrorIs(t, err, ErrKeyringEmpty)
+
+	full, err := NewKeyring()
+	require.NoError(t, err)
+	ciphertext, err := full.Encrypt([]byte("token"), nil)
+	require.NoError(t, err)
+	_, err = k.Reencrypt(ciphertext, nil)
+	require.ErrorIs(t, err, ErrKeyringEmpty)
+}
+
+func TestKeyringPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring")
+	passphrase := PasswordKey([]byte("secret"), &testKDFs[1])
+	k, err := LoadOrCreateKeyring(path, passphrase)
+	require.NoError(t, err)
+	_, err = k.Rotate()
+	require.NoError(t, err)
+	ciphertext, err := k.Encrypt([]byte("hello"), nil)
+	require.NoError(t, err)
+	require.NoError(t, k.Save(path, passphrase))
+
+	loaded, err := LoadOrCreateKeyring(path, PasswordKey([]byte("secret"), nil))
+	require.NoError(t, err)
+	require.Equal(t, k.IDs(), loaded.IDs())
+	plaintext, err := loaded.Decrypt(ciphertext, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), plaintext)
+	_, err = LoadKeyring(path, PasswordKey([]byte("wrong"), nil))
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	master, err := NewRandomKey()
+	require.NoError(t, err)
+	for _, encoded := range []string{hex.EncodeToString(master), base64.StdEncoding.EncodeToString(master), base64.RawURLEncoding.EncodeToString(master)} {
+		t.Setenv(DefaultMasterKeyEnv, encoded)
+		secret, err := SecretFromEnv(DefaultMasterKeyEnv)
+		require.NoError(t, err)
+		require.NoError(t, loaded.Save(path, secret))
+		fromEnv, err := LoadKeyring(path, secret)
+		require.NoError(t, err)
+		plaintext, err = fromEnv.Decrypt(ciphertext, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), plaintext)
+	}
+
+	// key IDs must be unique and increasing
+	secret := RawKey(master)
+	for _, keys := range [][]keyringKey{
+		{loaded.keys[1], loaded.keys[0]},
+		{loaded.keys[0], loaded.keys[0]},
+	} {
+		forged := &Keyring{master: loaded.master, keys: keys}
+		require.NoError(t, forged.Save(path, secret))
+		_, err = LoadKeyring(path, secret)
+		require.Error(t, err)
+	}
+	t.Setenv(DefaultMasterKeyEnv, "c2hvcnQ=")
+	_, err = SecretFromEnv(DefaultMasterKeyEnv)
+	require.Error(t, err)
+	_, err = SecretFromEnv("XCRYPTO_TEST_UNSET")
+	require.Error(t, err)
+}
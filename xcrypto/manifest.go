@@ -0,0 +1,297 @@
+package xcrypto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xfile"
+	"github.com/chaos-plus/chaos-plus-toolx/xgrpool"
+)
+
+// SumsFiles are the conventional manifest names, e.g. SHA256SUMS of sha256sum
+var SumsFiles = map[HashAlgorithm]string{
+	MD5:        "MD5SUMS",
+	SHA1:       "SHA1SUMS",
+	SHA256:     "SHA256SUMS",
+	SHA512:     "SHA512SUMS",
+	BLAKE2b512: "B2SUMS",
+}
+
+var ErrInvalidManifest = errors.New("xcrypto: invalid manifest")
+
+type ManifestOptions struct {
+	// Algorithm defaults to SHA256 when creating and to the manifest algorithm when verifying
+	Algorithm HashAlgorithm
+	// Workers limits the number of files hashed at once, defaults to the number of CPUs
+	Workers int
+	// Exclude skips slash separated relative paths, defaults to the SumsFiles in the root
+	Exclude func(path string) bool
+}
+
+// Manifest maps slash separated relative paths to hex digests
+type Manifest struct {
+	Algorithm HashAlgorithm
+	Files     map[string]string
+}
+
+// ManifestReport lists sorted relative paths that differ from a manifest
+type ManifestReport struct {
+	Modified []string
+	Missing  []string
+	Extra    []string
+}
+
+func (r *ManifestReport) OK() bool {
+	return len(r.Modified) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// CreateManifest hashes every regular file below dir
+func CreateManifest(dir string, opts *ManifestOptions) (*Manifest, error) {
+	opts = manifestOptions(opts, SHA256)
+	files, err := listManifestFiles(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	digests, err := hashFiles(dir, files, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{Algorithm: opts.Algorithm, Files: digests}, nil
+}
+
+// Verify hashes dir again, extra files are those below dir that are not in the manifest
+func (m *Manifest) Verify(dir string, opts *ManifestOptions) (*ManifestReport, error) {
+	opts = manifestOptions(opts, m.Algorithm)
+	files, err := listManifestFiles(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool, len(files))
+	report := &ManifestReport{}
+	listed := []string{}
+	for _, file := range files {
+		present[file] = true
+		if _, ok := m.Files[file]; ok {
+			listed = append(listed, file)
+		} else {
+			report.Extra = append(report.Extra, file)
+		}
+	}
+	for file := range m.Files {
+		if !present[file] {
+			report.Missing = append(report.Missing, file)
+		}
+	}
+	digests, err := hashFiles(dir, listed, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range listed {
+		if !strings.EqualFold(digests[file], m.Files[file]) {
+			report.Modified = append(report.Modified, file)
+		}
+	}
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// WriteTo writes the sha256sum format, sorted by path
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	files := make([]string, 0, len(m.Files))
+	for file := range m.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	buf := bytes.Buffer{}
+	for _, file := range files {
+		name := file
+		// sha256sum escapes names with a backslash or line breaks and marks the line
+		if strings.ContainsAny(name, "\\\n\r") {
+			buf.WriteString("\\")
+			name = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(name)
+		}
+		buf.WriteString(m.Files[file] + "  " + name + "\n")
+	}
+	return buf.WriteTo(w)
+}
+
+// Save writes the manifest to path, e.g. dir/SHA256SUMS
+func (m *Manifest) Save(path string) error {
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		return err
+	}
+	return writeFile(path, buf.Bytes(), 0644)
+}
+
+// ParseManifest reads the sha256sum format, an empty algorithm is guessed from the digest length
+func ParseManifest(r io.Reader, alg HashAlgorithm) (*Manifest, error) {
+	m := &Manifest{Algorithm: alg, Files: map[string]string{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+		digest, file, ok := strings.Cut(line, " ")
+		// text mode uses two spaces, binary mode a space and a star
+		if !ok || (!strings.HasPrefix(file, " ") && !strings.HasPrefix(file, "*")) {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidManifest, n)
+		}
+		file = file[1:]
+		if escaped {
+			file = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r").Replace(file)
+		}
+		if _, err := hex.DecodeString(digest); err != nil || file == "" {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidManifest, n)
+		}
+		file = path.Clean(strings.TrimPrefix(file, "./"))
+		if m.Algorithm == "" {
+			m.Algorithm = hashAlgorithmOf(digest)
+		}
+		m.Files[file] = strings.ToLower(digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.Algorithm == "" && len(m.Files) > 0 {
+		return nil, fmt.Errorf("%w: unknown digest algorithm", ErrInvalidManifest)
+	}
+	return m, nil
+}
+
+// LoadManifest takes the algorithm from a SumsFiles name, otherwise from the digest length
+func LoadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var alg HashAlgorithm
+	for a, name := range SumsFiles {
+		if strings.EqualFold(filepath.Base(path), name) {
+			alg = a
+		}
+	}
+	m, err := ParseManifest(f, alg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func hashAlgorithmOf(digest string) HashAlgorithm {
+	switch len(digest) {
+	case 8:
+		return CRC32
+	case 32:
+		return MD5
+	case 40:
+		return SHA1
+	case 64:
+		return SHA256
+	case 128:
+		return SHA512
+	}
+	return ""
+}
+
+func manifestOptions(opts *ManifestOptions, alg HashAlgorithm) *ManifestOptions {
+	o := ManifestOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = alg
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = SHA256
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.NumCPU()
+	}
+	if o.Exclude == nil {
+		o.Exclude = func(path string) bool {
+			for _, name := range SumsFiles {
+				if path == name {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return &o
+}
+
+func listManifestFiles(dir string, opts *ManifestOptions) ([]string, error) {
+	files, err := xfile.ListFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	kept := files[:0]
+	for _, file := range files {
+		if !opts.Exclude(file) {
+			kept = append(kept, file)
+		}
+	}
+	return kept, nil
+}
+
+// hashFiles hashes the files with opts.Workers goroutines and stops at the first error
+func hashFiles(dir string, files []string, opts *ManifestOptions) (map[string]string, error) {
+	if _, err := opts.Algorithm.New(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := xgrpool.NewWithContext(ctx)
+
+	paths := make(chan string)
+	digests := make(map[string]string, len(files))
+	mu := sync.Mutex{}
+	var firstErr error
+	for i := 0; i < opts.Workers && i < len(files); i++ {
+		pool.Add(func(ctx context.Context) error {
+			for file := range paths {
+				d, err := HashFile(filepath.Join(dir, filepath.FromSlash(file)), opts.Algorithm)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				digests[file] = d[opts.Algorithm]
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	for _, file := range files {
+		select {
+		case paths <- file:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(paths)
+	pool.Wait()
+	return digests, firstErr
+}
@@ -0,0 +1,389 @@
+package xcrypto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultCipherSuites are the ECDHE AEAD suites for TLS 1.2, TLS 1.3 suites are not configurable
+var DefaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// TLSConfigBuilder builds hardened server or client tls.Config values for mutual TLS.
+// Setters record the first error, Build returns it.
+type TLSConfigBuilder struct {
+	server       bool
+	minVersion   uint16
+	cipherSuites []uint16
+	certificate  *tls.Certificate
+	reloading    *ReloadingCertificate
+	cas          []*x509.Certificate
+	systemRoots  bool
+	clientAuth   *tls.ClientAuthType
+	serverName   string
+	allowedSANs  []string
+	allowedIDs   []string
+	err          error
+}
+
+// NewServerTLS requires verified client certificates once a client CA is added
+func NewServerTLS() *TLSConfigBuilder {
+	return &TLSConfigBuilder{server: true, minVersion: tls.VersionTLS12}
+}
+
+func NewClientTLS() *TLSConfigBuilder {
+	return &TLSConfigBuilder{minVersion: tls.VersionTLS12}
+}
+
+func (b *TLSConfigBuilder) SetMinVersion(version uint16) *TLSConfigBuilder {
+	b.minVersion = version
+	return b
+}
+
+func (b *TLSConfigBuilder) SetCipherSuites(suites ...uint16) *TLSConfigBuilder {
+	b.cipherSuites = suites
+	return b
+}
+
+func (b *TLSConfigBuilder) SetCertificate(cert *tls.Certificate) *TLSConfigBuilder {
+	b.certificate = cert
+	return b
+}
+
+func (b *TLSConfigBuilder) SetCertificateFiles(certFile, keyFile string, passphrase []byte) *TLSConfigBuilder {
+	certData, err := os.ReadFile(certFile)
+	if err != nil {
+		return b.fail(err)
+	}
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return b.fail(err)
+	}
+	cert, err := parseKeyPair(certData, keyData, passphrase)
+	if err != nil {
+		return b.fail(fmt.Errorf("xcrypto: %s: %w", certFile, err))
+	}
+	return b.SetCertificate(cert)
+}
+
+// SetReloadingCertificate serves the current pair of a ReloadingCertificate
+func (b *TLSConfigBuilder) SetReloadingCertificate(cert *ReloadingCertificate) *TLSConfigBuilder {
+	b.reloading = cert
+	return b
+}
+
+// AddCAs adds trusted CAs, client CAs for a server and root CAs for a client
+func (b *TLSConfigBuilder) AddCAs(certs ...*x509.Certificate) *TLSConfigBuilder {
+	b.cas = append(b.cas, certs...)
+	return b
+}
+
+func (b *TLSConfigBuilder) AddCAFiles(paths ...string) *TLSConfigBuilder {
+	for _, path := range paths {
+		certs, err := LoadCertificates(path)
+		if err != nil {
+			return b.fail(err)
+		}
+		b.cas = append(b.cas, certs...)
+	}
+	return b
+}
+
+// SetSystemRoots merges the added CAs with the system roots to verify servers,
+// client certificates are only verified against the added CAs
+func (b *TLSConfigBuilder) SetSystemRoots(systemRoots bool) *TLSConfigBuilder {
+	b.systemRoots = systemRoots
+	return b
+}
+
+func (b *TLSConfigBuilder) SetClientAuth(clientAuth tls.ClientAuthType) *TLSConfigBuilder {
+	b.clientAuth = &clientAuth
+	return b
+}
+
+func (b *TLSConfigBuilder) SetServerName(serverName string) *TLSConfigBuilder {
+	b.serverName = serverName
+	return b
+}
+
+// AllowSANs only accepts peers with one of the DNS, IP, email or URI names, "*.example.com" matches one label
+func (b *TLSConfigBuilder) AllowSANs(names ...string) *TLSConfigBuilder {
+	b.allowedSANs = append(b.allowedSANs, names...)
+	return b
+}
+
+// AllowSPIFFEIDs only accepts peers with one of the SPIFFE IDs, "spiffe://example.org" accepts the whole trust domain
+func (b *TLSConfigBuilder) AllowSPIFFEIDs(ids ...string) *TLSConfigBuilder {
+	for _, id := range ids {
+		u, err := url.Parse(id)
+		if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+			return b.fail(fmt.Errorf("xcrypto: invalid SPIFFE ID %q", id))
+		}
+		b.allowedIDs = append(b.allowedIDs, strings.TrimSuffix(id, "/"))
+	}
+	return b
+}
+
+func (b *TLSConfigBuilder) fail(err error) *TLSConfigBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+func (b *TLSConfigBuilder) Build() (*tls.Config, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	config := &tls.Config{
+		MinVersion:       b.minVersion,
+		CipherSuites:     b.cipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+		ServerName:       b.serverName,
+	}
+	if config.CipherSuites == nil {
+		config.CipherSuites = DefaultCipherSuites
+	}
+	if b.certificate != nil {
+		config.Certificates = []tls.Certificate{*b.certificate}
+	}
+	// public CAs must not authenticate clients, only servers trust the system roots
+	pool, err := b.pool(b.systemRoots && !b.server)
+	if err != nil {
+		return nil, err
+	}
+	verified := true
+	if b.server {
+		if b.reloading != nil {
+			config.GetCertificate = b.reloading.GetCertificate
+		}
+		if b.certificate == nil && b.reloading == nil {
+			return nil, errors.New("xcrypto: server TLS config requires a certificate")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.NoClientCert
+		if pool != nil {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		if b.clientAuth != nil {
+			config.ClientAuth = *b.clientAuth
+		}
+		if config.ClientAuth >= tls.VerifyClientCertIfGiven && pool == nil {
+			return nil, errors.New("xcrypto: client certificate verification requires client CAs")
+		}
+		verified = config.ClientAuth >= tls.VerifyClientCertIfGiven
+	} else {
+		if b.reloading != nil {
+			config.GetClientCertificate = b.reloading.GetClientCertificate
+		}
+		config.RootCAs = pool
+	}
+	if len(b.allowedSANs) > 0 || len(b.allowedIDs) > 0 {
+		if !verified {
+			return nil, errors.New("xcrypto: peer allowlists require verified client certificates")
+		}
+		config.VerifyPeerCertificate = b.verifyPeer
+	}
+	return config, nil
+}
+
+// pool returns nil to use the system roots when no CA was added
+func (b *TLSConfigBuilder) pool(systemRoots bool) (*x509.CertPool, error) {
+	if len(b.cas) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if systemRoots {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		pool = system
+	}
+	for _, ca := range b.cas {
+		pool.AddCert(ca)
+	}
+	return pool, nil
+}
+
+// verifyPeer runs after the chain was verified, a server without a client certificate passes
+func (b *TLSConfigBuilder) verifyPeer(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		if b.server && len(rawCerts) == 0 {
+			return nil
+		}
+		return errors.New("xcrypto: peer certificate was not verified")
+	}
+	leaf := verifiedChains[0][0]
+	if matchSANs(leaf, b.allowedSANs) || matchSPIFFEID(leaf, b.allowedIDs) {
+		return nil
+	}
+	return fmt.Errorf("xcrypto: peer certificate %s is not allowed", leaf.Subject)
+}
+
+func matchSANs(cert *x509.Certificate, allowed []string) bool {
+	for _, pattern := range allowed {
+		for _, name := range cert.DNSNames {
+			if matchDNSName(pattern, name) {
+				return true
+			}
+		}
+		if ip := net.ParseIP(pattern); ip != nil {
+			for _, certIP := range cert.IPAddresses {
+				if certIP.Equal(ip) {
+					return true
+				}
+			}
+		}
+		for _, email := range cert.EmailAddresses {
+			if strings.EqualFold(email, pattern) {
+				return true
+			}
+		}
+		for _, uri := range cert.URIs {
+			if uri.String() == pattern {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchDNSName(pattern, name string) bool {
+	pattern, name = strings.ToLower(strings.TrimSuffix(pattern, ".")), strings.ToLower(strings.TrimSuffix(name, "."))
+	if pattern == name {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, parent, found := strings.Cut(name, ".")
+		return found && label != "" && label != "*" && parent == suffix
+	}
+	return false
+}
+
+// matchSPIFFEID requires a single URI SAN as in the X.509-SVID spec
+func matchSPIFFEID(cert *x509.Certificate, allowed []string) bool {
+	if len(allowed) == 0 || len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" {
+		return false
+	}
+	id := strings.TrimSuffix(cert.URIs[0].String(), "/")
+	trustDomain := "spiffe://" + cert.URIs[0].Host
+	for _, pattern := range allowed {
+		if pattern == id || pattern == trustDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// TestPKI is a throwaway CA with a server and a client certificate for integration tests
+type TestPKI struct {
+	CA     *CA
+	Server *tls.Certificate
+	Client *tls.Certificate
+}
+
+// CreateTestPKI issues the server certificate for serverNames, they default to localhost.
+// Client IDs become URI SANs when they contain "://", IPs, emails or DNS names otherwise.
+func CreateTestPKI(serverNames []string, clientIDs ...string) (*TestPKI, error) {
+	if len(serverNames) == 0 {
+		serverNames = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	if len(clientIDs) == 0 {
+		clientIDs = []string{"client.localhost"}
+	}
+	ca, err := CreateCA(&CAOptions{
+		KeyAlgorithm: ECDSAP256,
+		Subject:      pkix.Name{CommonName: "xcrypto test CA"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	pki := &TestPKI{CA: ca}
+	if pki.Server, err = issueTestCert(ca, serverNames, x509.ExtKeyUsageServerAuth); err != nil {
+		return nil, err
+	}
+	if pki.Client, err = issueTestCert(ca, clientIDs, x509.ExtKeyUsageClientAuth); err != nil {
+		return nil, err
+	}
+	return pki, nil
+}
+
+func (p *TestPKI) ServerConfig() (*tls.Config, error) {
+	return NewServerTLS().SetCertificate(p.Server).AddCAs(p.CA.Cert).Build()
+}
+
+func (p *TestPKI) ClientConfig() (*tls.Config, error) {
+	return NewClientTLS().SetCertificate(p.Client).AddCAs(p.CA.Cert).Build()
+}
+
+// WriteFiles saves ca.pem, server.pem, server-key.pem, client.pem and client-key.pem into dir
+func (p *TestPKI) WriteFiles(dir string) error {
+	if err := SaveCertificates(filepath.Join(dir, CACertFile), PEM, p.CA.Cert); err != nil {
+		return err
+	}
+	for name, cert := range map[string]*tls.Certificate{"server": p.Server, "client": p.Client} {
+		if err := SaveCertificates(filepath.Join(dir, name+".pem"), PEM, cert.Leaf); err != nil {
+			return err
+		}
+		if err := SavePrivateKey(filepath.Join(dir, name+"-key.pem"), cert.PrivateKey, PKCS8, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func issueTestCert(ca *CA, names []string, usage x509.ExtKeyUsage) (*tls.Certificate, error) {
+	key, err := GenerateKey(ECDSAP256, 0)
+	if err != nil {
+		return nil, err
+	}
+	opts := &CSROptions{Subject: pkix.Name{CommonName: names[0]}, ExtKeyUsage: []x509.ExtKeyUsage{usage}}
+	for _, name := range names {
+		switch ip := net.ParseIP(name); {
+		case ip != nil:
+			opts.IPAddresses = append(opts.IPAddresses, ip)
+		case strings.Contains(name, "://"):
+			u, err := url.Parse(name)
+			if err != nil {
+				return nil, err
+			}
+			opts.URIs = append(opts.URIs, u)
+		case strings.Contains(name, "@"):
+			opts.EmailAddresses = append(opts.EmailAddresses, name)
+		default:
+			opts.DNSNames = append(opts.DNSNames, name)
+		}
+	}
+	csr, err := CreateCSR(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	policy := &IssuancePolicy{AllowIPs: true, AllowedEmails: opts.EmailAddresses}
+	for _, u := range opts.URIs {
+		policy.AllowedURIs = append(policy.AllowedURIs, u.String())
+	}
+	cert, err := ca.Sign(csr, policy)
+	if err != nil {
+		return nil, err
+	}
+	tlsCert, err := X509ToTlsCert(cert, key, ca.Cert)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsCert, nil
+}
@@ -0,0 +1,135 @@
+package xcrypto
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutualTLS(t *testing.T) {
+	pki, err := CreateTestPKI(nil, "spiffe://example.org/ns/default/sa/api")
+	require.NoError(t, err)
+	serverConfig, err := pki.ServerConfig()
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, serverConfig.ClientAuth)
+	clientConfig, err := pki.ClientConfig()
+	require.NoError(t, err)
+	clientConfig.ServerName = "localhost"
+	require.NoError(t, handshake(t, serverConfig, clientConfig))
+
+	// clients without a certificate are rejected
+	anonymous, err := NewClientTLS().AddCAs(pki.CA.Cert).SetServerName("localhost").Build()
+	require.NoError(t, err)
+	require.Error(t, handshake(t, serverConfig, anonymous))
+
+	server := func(b *TLSConfigBuilder) *tls.Config {
+		config, err := b.SetCertificate(pki.Server).AddCAs(pki.CA.Cert).Build()
+		require.NoError(t, err)
+		return config
+	}
+	require.NoError(t, handshake(t, server(NewServerTLS().AllowSPIFFEIDs("spiffe://example.org")), clientConfig))
+	require.NoError(t, handshake(t, server(NewServerTLS().AllowSPIFFEIDs("spiffe://example.org/ns/default/sa/api")), clientConfig))
+	require.Error(t, handshake(t, server(NewServerTLS().AllowSPIFFEIDs("spiffe://other.org")), clientConfig))
+	require.Error(t, handshake(t, server(NewServerTLS().AllowSANs("admin.localhost")), clientConfig))
+
+	// the client pins the server names
+	pinned, err := NewClientTLS().SetCertificate(pki.Client).AddCAs(pki.CA.Cert).
+		SetServerName("127.0.0.1").AllowSANs("*.example.com").Build()
+	require.NoError(t, err)
+	require.Error(t, handshake(t, serverConfig, pinned))
+	pinned, err = NewClientTLS().SetCertificate(pki.Client).AddCAs(pki.CA.Cert).
+		SetServerName("127.0.0.1").AllowSANs("127.0.0.1").SetMinVersion(tls.VersionTLS13).Build()
+	require.NoError(t, err)
+	require.NoError(t, handshake(t, serverConfig, pinned))
+}
+
+func TestTLSConfigBuilder(t *testing.T) {
+	pki, err := CreateTestPKI([]string{"api.localhost"}, "client@example.com")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, pki.WriteFiles(dir))
+
+	serverConfig, err := NewServerTLS().
+		SetCertificateFiles(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), nil).
+		AddCAFiles(filepath.Join(dir, CACertFile)).
+		AllowSANs("client@example.com").
+		Build()
+	require.NoError(t, err)
+	clientConfig, err := NewClientTLS().
+		SetCertificateFiles(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"), nil).
+		AddCAFiles(filepath.Join(dir, CACertFile)).
+		SetSystemRoots(true).
+		SetServerName("api.localhost").
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS12), clientConfig.MinVersion)
+	require.Equal(t, DefaultCipherSuites, clientConfig.CipherSuites)
+	require.NoError(t, handshake(t, serverConfig, clientConfig))
+
+	_, err = NewServerTLS().Build()
+	require.Error(t, err)
+	_, err = NewServerTLS().SetCertificate(pki.Server).SetClientAuth(tls.RequireAndVerifyClientCert).Build()
+	require.Error(t, err)
+	_, err = NewServerTLS().SetCertificate(pki.Server).SetClientAuth(tls.RequireAnyClientCert).AllowSANs("x").Build()
+	require.Error(t, err)
+	_, err = NewClientTLS().AllowSPIFFEIDs("https://example.org").Build()
+	require.Error(t, err)
+	_, err = NewClientTLS().AddCAFiles(filepath.Join(dir, "missing.pem")).Build()
+	require.Error(t, err)
+	config, err := NewServerTLS().SetCertificate(pki.Server).Build()
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	// servers never trust the system roots for client certificates
+	config, err = NewServerTLS().SetCertificate(pki.Server).AddCAs(pki.CA.Cert).SetSystemRoots(true).Build()
+	require.NoError(t, err)
+	expected := x509.NewCertPool()
+	expected.AddCert(pki.CA.Cert)
+	require.True(t, expected.Equal(config.ClientCAs))
+	require.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+}
+
+func TestMatchDNSName(t *testing.T) {
+	require.True(t, matchDNSName("api.example.com", "API.example.com."))
+	require.True(t, matchDNSName("*.example.com", "api.example.com"))
+	require.False(t, matchDNSName("*.example.com", "example.com"))
+	require.False(t, matchDNSName("*.example.com", "a.b.example.com"))
+}
+
+// handshake connects a client to a server and returns the first error of either side
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		if err := conn.(*tls.Conn).Handshake(); err != nil {
+			serverErr <- err
+			return
+		}
+		_, err = conn.Write([]byte("ok"))
+		serverErr <- err
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err == nil {
+		// TLS 1.3 reports a rejected client certificate on the first read
+		_, err = io.ReadFull(conn, make([]byte, 2))
+		conn.Close()
+	}
+	if err != nil {
+		listener.Close()
+		<-serverErr
+		return err
+	}
+	return <-serverErr
+}
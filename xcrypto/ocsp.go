@@ -0,0 +1,323 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	OCSPRequestContentType  = "application/ocsp-request"
+	OCSPResponseContentType = "application/ocsp-response"
+	DefaultOCSPUpdate       = time.Hour
+	maxOCSPRequestSize      = 64 * 1024
+)
+
+// OCSP response status of RFC 6960
+const (
+	ocspSuccessful       asn1.Enumerated = 0
+	ocspMalformedRequest asn1.Enumerated = 1
+	ocspInternalError    asn1.Enumerated = 2
+	ocspUnauthorized     asn1.Enumerated = 6
+)
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspTBSRequest struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   []ocspSingleRequest
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspSingleRequest struct {
+	CertID ocspCertID
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type ocspResponseData struct {
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPResponder answers OCSP requests for certificates issued by a CA, responses are signed by the CA itself
+type OCSPResponder struct {
+	CA *CA
+	// NextUpdate tells clients how long a response may be cached
+	NextUpdate time.Duration
+}
+
+func NewOCSPResponder(ca *CA) *OCSPResponder {
+	return &OCSPResponder{CA: ca, NextUpdate: DefaultOCSPUpdate}
+}
+
+func (o *OCSPResponder) SetNextUpdate(nextUpdate time.Duration) *OCSPResponder {
+	o.NextUpdate = nextUpdate
+	return o
+}
+
+// ServeHTTP accepts POST requests and the base64 GET form of RFC 6960 appendix A
+func (o *OCSPResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request []byte
+	switch r.Method {
+	case http.MethodPost:
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request = data
+	case http.MethodGet:
+		encoded, err := url.PathUnescape(r.URL.EscapedPath())
+		if err == nil {
+			request, err = decodeOCSPPath(encoded)
+		}
+		if err != nil {
+			http.Error(w, "invalid OCSP request encoding", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	response := o.Respond(request)
+	w.Header().Set("Content-Type", OCSPResponseContentType)
+	w.Write(response)
+}
+
+// decodeOCSPPath finds the base64 request in the path, it may contain slashes and follow a mount prefix
+func decodeOCSPPath(path string) ([]byte, error) {
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		if data, err := base64.StdEncoding.DecodeString(path[i+1:]); err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+	return nil, errors.New("xcrypto: invalid OCSP request encoding")
+}
+
+// Respond returns the DER OCSP response for a DER OCSP request, errors are encoded as OCSP error responses
+func (o *OCSPResponder) Respond(request []byte) []byte {
+	response, err := o.respond(request)
+	if err != nil {
+		status := ocspInternalError
+		var statusErr ocspStatusError
+		if errors.As(err, &statusErr) {
+			status = asn1.Enumerated(statusErr)
+		}
+		data, _ := asn1.Marshal(ocspResponse{Status: status})
+		return data
+	}
+	return response
+}
+
+type ocspStatusError asn1.Enumerated
+
+func (e ocspStatusError) Error() string {
+	return fmt.Sprintf("xcrypto: OCSP response status %d", int(e))
+}
+
+func (o *OCSPResponder) respond(data []byte) ([]byte, error) {
+	var request ocspRequest
+	if rest, err := asn1.Unmarshal(data, &request); err != nil || len(rest) > 0 {
+		return nil, ocspStatusError(ocspMalformedRequest)
+	}
+	if len(request.TBSRequest.RequestList) == 0 {
+		return nil, ocspStatusError(ocspMalformedRequest)
+	}
+	_, responderKeyHash, err := o.issuerHashes(oidSHA1)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	nextUpdate := o.NextUpdate
+	if nextUpdate <= 0 {
+		nextUpdate = DefaultOCSPUpdate
+	}
+	responses := make([]ocspSingleResponse, 0, len(request.TBSRequest.RequestList))
+	for _, single := range request.TBSRequest.RequestList {
+		id := single.CertID
+		nameHash, keyHash, err := o.issuerHashes(id.HashAlgorithm.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if string(id.NameHash) != string(nameHash) || string(id.IssuerKeyHash) != string(keyHash) {
+			return nil, ocspStatusError(ocspUnauthorized)
+		}
+		response := ocspSingleResponse{CertID: id, ThisUpdate: now, NextUpdate: now.Add(nextUpdate)}
+		record, ok := IssuedRecord{}, false
+		if o.CA.Registry != nil && id.SerialNumber != nil {
+			record, ok = o.CA.Registry.Get(id.SerialNumber)
+		}
+		switch {
+		case !ok:
+			response.Unknown = true
+		case record.RevokedAt != nil:
+			response.Revoked = ocspRevokedInfo{
+				RevocationTime: record.RevokedAt.UTC(),
+				Reason:         asn1.Enumerated(record.RevocationReason),
+			}
+		default:
+			response.Good = true
+		}
+		responses = append(responses, response)
+	}
+	responseData := ocspResponseData{
+		// responderID byKey [2] EXPLICIT KeyHash
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: mustMarshal(responderKeyHash)},
+		ProducedAt:  now,
+		Responses:   responses,
+	}
+	for _, ext := range request.TBSRequest.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			responseData.Extensions = append(responseData.Extensions, pkix.Extension{Id: oidOCSPNonce, Value: ext.Value})
+		}
+	}
+	tbs, err := asn1.Marshal(responseData)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, signature, err := signOCSP(o.CA.Key, tbs)
+	if err != nil {
+		return nil, err
+	}
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: algorithm,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ocspResponse{
+		Status:   ocspSuccessful,
+		Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic},
+	})
+}
+
+func (o *OCSPResponder) issuerHashes(algorithm asn1.ObjectIdentifier) ([]byte, []byte, error) {
+	var hash crypto.Hash
+	switch {
+	case algorithm.Equal(oidSHA1):
+		hash = crypto.SHA1
+	case algorithm.Equal(oidSHA256):
+		hash = crypto.SHA256
+	default:
+		return nil, nil, ocspStatusError(ocspMalformedRequest)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(o.CA.Cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, err
+	}
+	h := hash.New()
+	h.Write(o.CA.Cert.RawSubject)
+	nameHash := h.Sum(nil)
+	h = hash.New()
+	h.Write(spki.PublicKey.RightAlign())
+	return nameHash, h.Sum(nil), nil
+}
+
+func signOCSP(key crypto.Signer, tbs []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(tbs)
+		signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, signature, err
+	case *ecdsa.PublicKey:
+		if pub.Curve == elliptic.P384() {
+			h := crypto.SHA384.New()
+			h.Write(tbs)
+			signature, err := key.Sign(rand.Reader, h.Sum(nil), crypto.SHA384)
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, signature, err
+		}
+		digest := sha256.Sum256(tbs)
+		signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, signature, err
+	case ed25519.PublicKey:
+		signature, err := key.Sign(rand.Reader, tbs, crypto.Hash(0))
+		return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, signature, err
+	default:
+		return pkix.AlgorithmIdentifier{}, nil, fmt.Errorf("xcrypto: unsupported OCSP signing key %T", pub)
+	}
+}
+
+func mustMarshal(v any) []byte {
+	data, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
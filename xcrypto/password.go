@@ -0,0 +1,145 @@
+package xcrypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultPasswordParams are used by HashPassword without params, VerifyPassword asks to rehash other hashes
+var DefaultPasswordParams = DefaultArgon2id
+
+var ErrInvalidPasswordHash = errors.New("xcrypto: invalid password hash")
+
+// phc strings use standard base64 without padding
+var phcEncoding = base64.RawStdEncoding
+
+// HashPassword returns a PHC string, e.g. $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+func HashPassword(password string, params *KDFParams) (string, error) {
+	p := DefaultPasswordParams
+	if params != nil {
+		p = *params
+	}
+	if p.KDF == KDFPBKDF2SHA256 && p.Iterations == 0 {
+		p.Iterations = uint32(PBKDF2Iterations)
+	}
+	// VerifyPassword rejects hashes beyond the limits
+	if err := p.checkLimits(); err != nil {
+		return "", err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	hash, err := deriveKey([]byte(password), salt, p, KeySize)
+	if err != nil {
+		return "", err
+	}
+	var id, settings string
+	switch p.KDF {
+	case KDFArgon2id:
+		id, settings = "argon2id", fmt.Sprintf("v=19$m=%d,t=%d,p=%d", p.ArgonMemory, p.ArgonTime, p.ArgonThreads)
+	case KDFScrypt:
+		if p.ScryptN < 2 || p.ScryptN&(p.ScryptN-1) != 0 {
+			return "", errors.New("xcrypto: scrypt N must be a power of two")
+		}
+		id, settings = "scrypt", fmt.Sprintf("ln=%d,r=%d,p=%d", log2(p.ScryptN), p.ScryptR, p.ScryptP)
+	case KDFPBKDF2SHA256:
+		id, settings = "pbkdf2-sha256", fmt.Sprintf("i=%d", p.Iterations)
+	default:
+		return "", fmt.Errorf("xcrypto: unsupported KDF %d", p.KDF)
+	}
+	return fmt.Sprintf("$%s$%s$%s$%s", id, settings, phcEncoding.EncodeToString(salt), phcEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPassword compares in constant time, needsRehash reports a hash
+// that does not use DefaultPasswordParams and should be replaced after a successful login
+func VerifyPassword(password, encoded string) (match bool, needsRehash bool, err error) {
+	params, salt, hash, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	derived, err := deriveKey([]byte(password), salt, params, len(hash))
+	if err != nil {
+		return false, false, err
+	}
+	if subtle.ConstantTimeCompare(derived, hash) != 1 {
+		return false, false, nil
+	}
+	current := DefaultPasswordParams
+	if current.KDF == KDFPBKDF2SHA256 && current.Iterations == 0 {
+		current.Iterations = uint32(PBKDF2Iterations)
+	}
+	return true, params != current || len(salt) < saltSize || len(hash) < KeySize, nil
+}
+
+func parsePasswordHash(encoded string) (KDFParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	// "", id, [version,] settings, salt, hash
+	if len(parts) < 5 || parts[0] != "" {
+		return KDFParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+	id, fields := parts[1], parts[2:]
+	if id == "argon2id" && len(fields) == 4 {
+		if fields[0] != "v=19" {
+			return KDFParams{}, nil, nil, fmt.Errorf("%w: unsupported argon2 version %s", ErrInvalidPasswordHash, fields[0])
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 3 {
+		return KDFParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+	settings := map[string]uint32{}
+	for _, setting := range strings.Split(fields[0], ",") {
+		name, value, ok := strings.Cut(setting, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if !ok || err != nil {
+			return KDFParams{}, nil, nil, ErrInvalidPasswordHash
+		}
+		settings[name] = uint32(n)
+	}
+	params := KDFParams{}
+	var err error
+	switch id {
+	case "argon2id":
+		params.KDF = KDFArgon2id
+		err = params.decode(settings["t"], settings["m"], settings["p"])
+	case "scrypt":
+		params.KDF = KDFScrypt
+		if settings["ln"] == 0 || settings["ln"] > 31 {
+			return KDFParams{}, nil, nil, ErrInvalidPasswordHash
+		}
+		err = params.decode(1<<settings["ln"], settings["r"], settings["p"])
+	case "pbkdf2-sha256":
+		params.KDF = KDFPBKDF2SHA256
+		err = params.decode(settings["i"], 0, 0)
+	default:
+		return KDFParams{}, nil, nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidPasswordHash, id)
+	}
+	if err != nil {
+		return KDFParams{}, nil, nil, err
+	}
+	salt, err := phcEncoding.DecodeString(fields[1])
+	if err != nil {
+		return KDFParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+	hash, err := phcEncoding.DecodeString(fields[2])
+	if err != nil || len(hash) < 16 || len(hash) > 128 {
+		return KDFParams{}, nil, nil, ErrInvalidPasswordHash
+	}
+	return params, salt, hash, nil
+}
+
+func log2(n uint32) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
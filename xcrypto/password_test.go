@@ -0,0 +1,88 @@
+package xcrypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	defaults := DefaultPasswordParams
+	defer func() { DefaultPasswordParams = defaults }()
+	DefaultPasswordParams = testKDFs[1]
+
+	for _, params := range testKDFs {
+		hash, err := HashPassword("correct horse", &params)
+		require.NoError(t, err)
+		match, rehash, err := VerifyPassword("correct horse", hash)
+		require.NoError(t, err)
+		require.True(t, match, hash)
+		require.Equal(t, params.KDF != KDFArgon2id, rehash, hash)
+		match, _, err = VerifyPassword("wrong horse", hash)
+		require.NoError(t, err)
+		require.False(t, match)
+	}
+
+	hash, err := HashPassword("correct horse", nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+	hashed, err := HashPassword("correct horse", nil)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, hashed)
+
+	// stronger defaults ask existing hashes to be upgraded
+	DefaultPasswordParams.ArgonTime = 2
+	match, rehash, err := VerifyPassword("correct horse", hash)
+	require.NoError(t, err)
+	require.True(t, match)
+	require.True(t, rehash)
+}
+
+func TestVerifyPasswordVectors(t *testing.T) {
+	for _, hash := range []string{
+		// x/crypto/argon2 test vector
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+	} {
+		match, rehash, err := VerifyPassword("password", hash)
+		require.NoError(t, err)
+		require.True(t, match)
+		require.True(t, rehash)
+	}
+	// python hashlib.scrypt and hashlib.pbkdf2_hmac
+	for _, hash := range []string{
+		"$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$A9lBa6RTbfBovWqamVIqXKovIl4Vk6OZyVojLJmYmSI",
+		"$pbkdf2-sha256$i=1000$c2FsdHNhbHRzYWx0c2FsdA$BBs+1+PaslLtBPULUr8/lQicvVuHiEPMz0i8MjLCbzM",
+	} {
+		match, _, err := VerifyPassword("correct horse", hash)
+		require.NoError(t, err)
+		require.True(t, match, hash)
+	}
+
+	for _, hash := range []string{
+		"",
+		"plain",
+		"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$argon2id$v=19$m=99999999,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$bcrypt$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$pbkdf2-sha256$i=x$c2FsdA$BBs",
+		"$scrypt$ln=40,r=8,p=1$c2FsdA$A9lBa6RTbfBovWqamVIqXKovIl4Vk6OZyVojLJmYmSI",
+	} {
+		_, _, err := VerifyPassword("password", hash)
+		require.Error(t, err, hash)
+	}
+
+	// stored hashes with huge parameters are rejected before deriving
+	for _, hash := range []string{
+		"$scrypt$ln=22,r=1024,p=1$c2FsdA$A9lBa6RTbfBovWqamVIqXKovIl4Vk6OZyVojLJmYmSI",
+		"$scrypt$ln=15,r=8,p=1024$c2FsdA$A9lBa6RTbfBovWqamVIqXKovIl4Vk6OZyVojLJmYmSI",
+		"$argon2id$v=19$m=4194304,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$argon2id$v=19$m=64,t=50000000,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$pbkdf2-sha256$i=4000000000$c2FsdA$BBs+1+PaslLtBPULUr8/lQicvVuHiEPMz0i8MjLCbzM",
+	} {
+		_, _, err := VerifyPassword("password", hash)
+		require.ErrorContains(t, err, "exceed limits", hash)
+	}
+	_, err := HashPassword("password", &KDFParams{KDF: KDFArgon2id, ArgonTime: 1, ArgonMemory: 4 << 20, ArgonThreads: 1})
+	require.Error(t, err)
+}
@@ -0,0 +1,364 @@
+package xcrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xfile"
+)
+
+const (
+	PEMTypeCertificate         = "CERTIFICATE"
+	PEMTypePrivateKey          = "PRIVATE KEY"
+	PEMTypeEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+	PEMTypeRSAPrivateKey       = "RSA PRIVATE KEY"
+	PEMTypeECPrivateKey        = "EC PRIVATE KEY"
+	PEMTypePublicKey           = "PUBLIC KEY"
+	PEMTypeRSAPublicKey        = "RSA PUBLIC KEY"
+
+	CACertFile = "ca.pem"
+	CAKeyFile  = "ca-key.pem"
+)
+
+type KeyFormat int
+
+const (
+	PKCS8 KeyFormat = iota
+	PKCS1           // RSA keys only
+	SEC1            // ECDSA keys only
+)
+
+type Encoding int
+
+const (
+	PEM Encoding = iota
+	DER
+)
+
+// EncodeCertificates encodes certificates as PEM blocks or concatenated DER
+func EncodeCertificates(encoding Encoding, certs ...*x509.Certificate) []byte {
+	buffer := bytes.Buffer{}
+	for _, cert := range certs {
+		if encoding == DER {
+			buffer.Write(cert.Raw)
+		} else {
+			pem.Encode(&buffer, &pem.Block{Type: PEMTypeCertificate, Bytes: cert.Raw})
+		}
+	}
+	return buffer.Bytes()
+}
+
+// ParseCertificates parses PEM or DER certificates, the encoding is detected automatically
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !isPEM(data) {
+		return x509.ParseCertificates(data)
+	}
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != PEMTypeCertificate {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("xcrypto: no certificate found")
+	}
+	return certs, nil
+}
+
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificates of %s: %v", path, err)
+	}
+	return certs, nil
+}
+
+// LoadCertificate returns the first certificate of the file
+func LoadCertificate(path string) (*x509.Certificate, error) {
+	certs, err := LoadCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+func SaveCertificates(path string, encoding Encoding, certs ...*x509.Certificate) error {
+	return writeFile(path, EncodeCertificates(encoding, certs...), 0644)
+}
+
+// MarshalPrivateKey encodes the key in the given format, PKCS8 supports every key type
+func MarshalPrivateKey(key crypto.PrivateKey, format KeyFormat) ([]byte, error) {
+	switch format {
+	case PKCS1:
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("xcrypto: PKCS#1 requires an RSA key, got %T", key)
+		}
+		return x509.MarshalPKCS1PrivateKey(rsaKey), nil
+	case SEC1:
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("xcrypto: SEC 1 requires an ECDSA key, got %T", key)
+		}
+		return x509.MarshalECPrivateKey(ecKey)
+	default:
+		return x509.MarshalPKCS8PrivateKey(key)
+	}
+}
+
+// EncodePrivateKey encodes the key as PEM or DER, a passphrase requires PKCS8 and encrypts the key
+func EncodePrivateKey(key crypto.PrivateKey, format KeyFormat, encoding Encoding, passphrase []byte) ([]byte, error) {
+	der, err := MarshalPrivateKey(key, format)
+	if err != nil {
+		return nil, err
+	}
+	blockType := map[KeyFormat]string{PKCS8: PEMTypePrivateKey, PKCS1: PEMTypeRSAPrivateKey, SEC1: PEMTypeECPrivateKey}[format]
+	if len(passphrase) > 0 {
+		if format != PKCS8 {
+			return nil, errors.New("xcrypto: only PKCS#8 keys can be encrypted")
+		}
+		if der, err = encryptPKCS8(der, passphrase); err != nil {
+			return nil, err
+		}
+		blockType = PEMTypeEncryptedPrivateKey
+	}
+	if encoding == DER {
+		return der, nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), nil
+}
+
+// ParsePrivateKey parses a PEM or DER key in PKCS#1, PKCS#8 or SEC 1 format,
+// encrypted PKCS#8 and legacy encrypted PEM keys are decrypted with passphrase
+func ParsePrivateKey(data []byte, passphrase []byte) (crypto.Signer, error) {
+	if !isPEM(data) {
+		if key, err := parsePrivateKeyDER(data); err == nil {
+			return key, nil
+		}
+		if len(passphrase) == 0 {
+			return nil, errors.New("xcrypto: failed to parse private key, it may be encrypted")
+		}
+		der, err := decryptPKCS8(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return parsePrivateKeyDER(der)
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("xcrypto: no private key found")
+		}
+		der := block.Bytes
+		switch {
+		case block.Type == PEMTypeEncryptedPrivateKey:
+			if len(passphrase) == 0 {
+				return nil, errors.New("xcrypto: private key is encrypted, a passphrase is required")
+			}
+			plain, err := decryptPKCS8(der, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			der = plain
+		case x509.IsEncryptedPEMBlock(block): // legacy "Proc-Type: 4,ENCRYPTED" keys
+			if len(passphrase) == 0 {
+				return nil, errors.New("xcrypto: private key is encrypted, a passphrase is required")
+			}
+			plain, err := x509.DecryptPEMBlock(block, passphrase)
+			if err != nil {
+				return nil, ErrIncorrectPassphrase
+			}
+			der = plain
+		case block.Type != PEMTypePrivateKey && block.Type != PEMTypeRSAPrivateKey && block.Type != PEMTypeECPrivateKey:
+			continue // e.g. "EC PARAMETERS" written by openssl
+		}
+		return parsePrivateKeyDER(der)
+	}
+}
+
+func parsePrivateKeyDER(der []byte) (crypto.Signer, error) {
+	var key any
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil, errors.New("xcrypto: unknown private key format")
+			}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("xcrypto: unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+func LoadPrivateKey(path string, passphrase []byte) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// SavePrivateKey writes the key as PEM readable only by the owner
+func SavePrivateKey(path string, key crypto.PrivateKey, format KeyFormat, passphrase []byte) error {
+	data, err := EncodePrivateKey(key, format, PEM, passphrase)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data, 0600)
+}
+
+// EncodePublicKey encodes the key as PKIX, PEM or DER
+func EncodePublicKey(key crypto.PublicKey, encoding Encoding) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == DER {
+		return der, nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypePublicKey, Bytes: der}), nil
+}
+
+// ParsePublicKey parses a PEM or DER public key in PKIX or PKCS#1 format, or the key of a certificate
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	der := data
+	if isPEM(data) {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("xcrypto: invalid public key PEM")
+		}
+		der = block.Bytes
+		if block.Type == PEMTypeRSAPublicKey {
+			return x509.ParsePKCS1PublicKey(der)
+		}
+	}
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return cert.PublicKey, nil
+	}
+	return nil, errors.New("xcrypto: unknown public key format")
+}
+
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+func SavePublicKey(path string, key crypto.PublicKey, encoding Encoding) error {
+	data, err := EncodePublicKey(key, encoding)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data, 0644)
+}
+
+// SaveCA writes the CA certificate and key into dir as CACertFile and CAKeyFile
+func SaveCA(dir string, ca *CA, passphrase []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := SavePrivateKey(filepath.Join(dir, CAKeyFile), ca.Key, PKCS8, passphrase); err != nil {
+		return err
+	}
+	return SaveCertificates(filepath.Join(dir, CACertFile), PEM, ca.Cert)
+}
+
+func LoadCA(dir string, passphrase []byte) (*CA, error) {
+	cert, err := LoadCertificate(filepath.Join(dir, CACertFile))
+	if err != nil {
+		return nil, err
+	}
+	key, err := LoadPrivateKey(filepath.Join(dir, CAKeyFile), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKeyPair(cert, key); err != nil {
+		return nil, err
+	}
+	return &CA{Key: key, Cert: cert}, nil
+}
+
+// LoadOrCreateCA loads the CA from dir or creates and saves a new one,
+// dir defaults to the "ca" directory in the user config of the executable
+func LoadOrCreateCA(dir string) (*CA, error) {
+	return LoadOrCreateCAWithOptions(dir, nil, nil)
+}
+
+func LoadOrCreateCAWithOptions(dir string, opts *CAOptions, passphrase []byte) (*CA, error) {
+	if dir == "" {
+		configDir, err := xfile.GetExecutableUserConfig("ca")
+		if err != nil {
+			return nil, err
+		}
+		dir = configDir
+	}
+	if xfile.IsFile(filepath.Join(dir, CACertFile)) {
+		return LoadCA(dir, passphrase)
+	}
+	ca, err := CreateCA(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveCA(dir, ca, passphrase); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// checkKeyPair verifies that key belongs to the certificate
+func checkKeyPair(cert *x509.Certificate, key crypto.Signer) error {
+	if !PublicKeyEqual(key.Public(), cert.PublicKey) {
+		return errors.New("xcrypto: private key does not match certificate")
+	}
+	return nil
+}
+
+func isPEM(data []byte) bool {
+	return bytes.Contains(data, []byte("-----BEGIN "))
+}
+
+// writeFile replaces path atomically, a crash never leaves a truncated key or certificate
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := xfile.MkdirParent(path); err != nil {
+		return err
+	}
+	return xfile.WriteFileAtomic(path, data, &xfile.AtomicOptions{Perm: perm})
+}
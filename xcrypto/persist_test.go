@@ -0,0 +1,146 @@
+package xcrypto
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateKeyEncoding(t *testing.T) {
+	defer func(iterations int) { PBKDF2Iterations = iterations }(PBKDF2Iterations)
+	PBKDF2Iterations = 1000
+	passphrase := []byte("secret")
+	for _, alg := range []KeyAlgorithm{RSA, ECDSAP256, ECDSAP384, Ed25519} {
+		key, err := GenerateKey(alg, 0)
+		require.NoError(t, err)
+		formats := []KeyFormat{PKCS8}
+		switch alg {
+		case RSA:
+			formats = append(formats, PKCS1)
+		case ECDSAP256, ECDSAP384:
+			formats = append(formats, SEC1)
+		}
+		for _, format := range formats {
+			for _, encoding := range []Encoding{PEM, DER} {
+				data, err := EncodePrivateKey(key, format, encoding, nil)
+				require.NoError(t, err)
+				parsed, err := ParsePrivateKey(data, nil)
+				require.NoError(t, err, alg)
+				require.True(t, PublicKeyEqual(key.Public(), parsed.Public()))
+			}
+		}
+
+		for _, encoding := range []Encoding{PEM, DER} {
+			data, err := EncodePrivateKey(key, PKCS8, encoding, passphrase)
+			require.NoError(t, err)
+			_, err = ParsePrivateKey(data, nil)
+			require.Error(t, err)
+			_, err = ParsePrivateKey(data, []byte("wrong"))
+			require.Error(t, err)
+			parsed, err := ParsePrivateKey(data, passphrase)
+			require.NoError(t, err)
+			require.True(t, PublicKeyEqual(key.Public(), parsed.Public()))
+		}
+
+		for _, encoding := range []Encoding{PEM, DER} {
+			data, err := EncodePublicKey(key.Public(), encoding)
+			require.NoError(t, err)
+			pub, err := ParsePublicKey(data)
+			require.NoError(t, err)
+			require.True(t, PublicKeyEqual(key.Public(), pub))
+		}
+	}
+
+	key, err := GenerateKey(Ed25519, 0)
+	require.NoError(t, err)
+	_, err = EncodePrivateKey(key, PKCS1, PEM, nil)
+	require.Error(t, err)
+}
+
+func TestCertificateEncoding(t *testing.T) {
+	root, err := CreateCA(nil)
+	require.NoError(t, err)
+	issuer, err := NewCertIssuer(root, nil)
+	require.NoError(t, err)
+	leaf, err := issuer.Issue("example.com")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	for _, encoding := range []Encoding{PEM, DER} {
+		path := filepath.Join(dir, "chain")
+		require.NoError(t, SaveCertificates(path, encoding, leaf.Leaf, root.Cert))
+		certs, err := LoadCertificates(path)
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+		require.True(t, certs[0].Equal(leaf.Leaf))
+		require.True(t, certs[1].Equal(root.Cert))
+	}
+	pub, err := ParsePublicKey(EncodeCertificates(PEM, root.Cert))
+	require.NoError(t, err)
+	require.Equal(t, root.Cert.PublicKey, pub)
+}
+
+func TestLoadOrCreateCA(t *testing.T) {
+	defer func(iterations int) { PBKDF2Iterations = iterations }(PBKDF2Iterations)
+	PBKDF2Iterations = 1000
+	dir := filepath.Join(t.TempDir(), "ca")
+	ca, err := LoadOrCreateCA(dir)
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, CAKeyFile))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadOrCreateCA(dir)
+	require.NoError(t, err)
+	require.True(t, ca.Cert.Equal(loaded.Cert))
+
+	dir = filepath.Join(t.TempDir(), "encrypted")
+	ca, err = LoadOrCreateCAWithOptions(dir, &CAOptions{KeyAlgorithm: RSA}, []byte("secret"))
+	require.NoError(t, err)
+	_, err = LoadCA(dir, []byte("wrong"))
+	require.ErrorIs(t, err, ErrIncorrectPassphrase)
+	loaded, err = LoadOrCreateCAWithOptions(dir, nil, []byte("secret"))
+	require.NoError(t, err)
+	require.Equal(t, x509.RSA, loaded.Cert.PublicKeyAlgorithm)
+	require.True(t, ca.Cert.Equal(loaded.Cert))
+}
+
+func TestForgedPBKDF2Params(t *testing.T) {
+	forge := func(mutate func(*pbkdf2Params)) []byte {
+		algorithm, encrypted, err := encryptPBES2([]byte("0123456789abcdef"), []byte("secret"), 1000)
+		require.NoError(t, err)
+		var params pbes2Params
+		_, err = asn1.Unmarshal(algorithm.Parameters.FullBytes, &params)
+		require.NoError(t, err)
+		var kdf pbkdf2Params
+		_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+		require.NoError(t, err)
+		mutate(&kdf)
+		kdfParams, err := asn1.Marshal(kdf)
+		require.NoError(t, err)
+		params.KeyDerivationFunc.Parameters = asn1.RawValue{FullBytes: kdfParams}
+		algorithm.Parameters.FullBytes, err = asn1.Marshal(params)
+		require.NoError(t, err)
+		der, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: encrypted})
+		require.NoError(t, err)
+		return der
+	}
+
+	_, err := decryptPKCS8(forge(func(*pbkdf2Params) {}), []byte("secret"))
+	require.NoError(t, err)
+	for name, mutate := range map[string]func(*pbkdf2Params){
+		"huge iterations": func(kdf *pbkdf2Params) { kdf.IterationCount = 1 << 40 },
+		"zero iterations": func(kdf *pbkdf2Params) { kdf.IterationCount = 0 },
+		"short salt":      func(kdf *pbkdf2Params) { kdf.Salt = kdf.Salt[:4] },
+		"long salt":       func(kdf *pbkdf2Params) { kdf.Salt = make([]byte, 1<<20) },
+		"key length":      func(kdf *pbkdf2Params) { kdf.KeyLength = 1 << 30 },
+	} {
+		_, err := decryptPKCS8(forge(mutate), []byte("secret"))
+		require.Error(t, err, name)
+		require.NotErrorIs(t, err, ErrIncorrectPassphrase, name)
+	}
+}
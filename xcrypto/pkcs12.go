@@ -0,0 +1,321 @@
+package xcrypto
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+)
+
+// PKCS12Iterations is used for the MAC and the legacy encryption, like openssl
+var PKCS12Iterations = 2048
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidCertBag                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidPKCS8ShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidX509Certificate          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBEWithSHAAnd3KeyTDES    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	// Java keystores only trust certificate bags with this attribute
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+type PKCS12Options struct {
+	// FriendlyName is shown by certificate managers, defaults to the common name of the first certificate
+	FriendlyName string
+	// Legacy uses 3DES and a SHA-1 MAC for older clients, otherwise AES-256-CBC and a SHA-256 MAC are used
+	Legacy bool
+}
+
+// RFC 7292 structures
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data asn1.RawValue
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// EncodePKCS12 creates a password protected PKCS#12 file, key may be nil for a trust store of certs
+func EncodePKCS12(key crypto.PrivateKey, certs []*x509.Certificate, password string, opts *PKCS12Options) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("xcrypto: PKCS#12 requires a certificate")
+	}
+	if opts == nil {
+		opts = &PKCS12Options{}
+	}
+	name := opts.FriendlyName
+	if name == "" {
+		name = certs[0].Subject.CommonName
+	}
+	var localKeyID []byte
+	if key != nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("xcrypto: PKCS#12 key is not a crypto.Signer")
+		}
+		if err := checkKeyPair(certs[0], signer); err != nil {
+			return nil, err
+		}
+		sum := sha1.Sum(certs[0].Raw)
+		localKeyID = sum[:]
+	}
+
+	certBags := []safeBag{}
+	for i, cert := range certs {
+		value, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: explicitTag(mustMarshal(cert.Raw))})
+		if err != nil {
+			return nil, err
+		}
+		bag := safeBag{ID: oidCertBag, Value: explicitTag(value)}
+		if i == 0 {
+			bag.Attributes = append(bag.Attributes, friendlyNameAttribute(name))
+			if localKeyID != nil {
+				bag.Attributes = append(bag.Attributes, pkcs12Attribute{ID: oidLocalKeyID, Values: []asn1.RawValue{{FullBytes: mustMarshal(localKeyID)}}})
+			}
+		}
+		if key == nil {
+			bag.Attributes = append(bag.Attributes, pkcs12Attribute{ID: oidJavaTrustedKeyUsage, Values: []asn1.RawValue{{FullBytes: mustMarshal(oidAnyExtendedKeyUsage)}}})
+		}
+		certBags = append(certBags, bag)
+	}
+	certContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, encrypted, err := encryptPKCS12(certContents, password, opts.Legacy)
+	if err != nil {
+		return nil, err
+	}
+	encryptedCerts, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidDataContentType,
+			ContentEncryptionAlgorithm: algorithm,
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encrypted},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	authSafe := []contentInfo{{ContentType: oidEncryptedDataContentType, Content: explicitTag(encryptedCerts)}}
+
+	if key != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		algorithm, encrypted, err := encryptPKCS12(der, password, opts.Legacy)
+		if err != nil {
+			return nil, err
+		}
+		shrouded, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: algorithm, EncryptedData: encrypted})
+		if err != nil {
+			return nil, err
+		}
+		keyContents, err := asn1.Marshal([]safeBag{{
+			ID:    oidPKCS8ShroudedKeyBag,
+			Value: explicitTag(shrouded),
+			Attributes: []pkcs12Attribute{
+				friendlyNameAttribute(name),
+				{ID: oidLocalKeyID, Values: []asn1.RawValue{{FullBytes: mustMarshal(localKeyID)}}},
+			},
+		}})
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, contentInfo{ContentType: oidDataContentType, Content: explicitTag(mustMarshal(keyContents))})
+	}
+
+	authSafeContents, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := pkcs12MAC(authSafeContents, password, opts.Legacy)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidDataContentType, Content: explicitTag(mustMarshal(authSafeContents))},
+		MacData:  mac,
+	})
+}
+
+// encryptPKCS12 uses PBES2 with the UTF-8 password or the legacy PKCS#12 PBE with the BMP password
+func encryptPKCS12(data []byte, password string, legacy bool) (pkix.AlgorithmIdentifier, []byte, error) {
+	if !legacy {
+		return encryptPBES2(data, []byte(password), PBKDF2Iterations)
+	}
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	bmp := bmpPassword(password)
+	key := pkcs12KDF(sha1.New, salt, bmp, PKCS12Iterations, 1, 24)
+	iv := pkcs12KDF(sha1.New, salt, bmp, PKCS12Iterations, 2, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	padding := des.BlockSize - len(data)%des.BlockSize
+	plain := append(append([]byte{}, data...), make([]byte, padding)...)
+	for i := len(data); i < len(plain); i++ {
+		plain[i] = byte(padding)
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: PKCS12Iterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3KeyTDES, Parameters: asn1.RawValue{FullBytes: params}}, encrypted, nil
+}
+
+func pkcs12MAC(data []byte, password string, legacy bool) (macData, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return macData{}, err
+	}
+	newHash, algorithm := sha256.New, oidSHA256
+	if legacy {
+		newHash, algorithm = sha1.New, oidSHA1
+	}
+	key := pkcs12KDF(newHash, salt, bmpPassword(password), PKCS12Iterations, 3, newHash().Size())
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return macData{
+		Mac:        digestInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: algorithm, Parameters: asn1NullRawValue}, Digest: mac.Sum(nil)},
+		MacSalt:    salt,
+		Iterations: PKCS12Iterations,
+	}, nil
+}
+
+// pkcs12KDF derives keys (id 1), ivs (id 2) and MAC keys (id 3) as in RFC 7292 appendix B.2
+func pkcs12KDF(newHash func() hash.Hash, salt, password []byte, iterations int, id byte, size int) []byte {
+	h := newHash()
+	u, v := h.Size(), h.BlockSize()
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(data)+v-1)/v))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	input := append(fill(salt), fill(password)...)
+	out := make([]byte, 0, size+u)
+	one := big.NewInt(1)
+	for len(out) < size {
+		h.Reset()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		out = append(out, a...)
+		if len(out) >= size {
+			break
+		}
+		// every v byte block of the input becomes block + B + 1, B is a repeated to v bytes
+		b := new(big.Int).SetBytes(fill(a)[:v])
+		b.Add(b, one)
+		for j := 0; j < len(input); j += v {
+			block := new(big.Int).SetBytes(input[j : j+v])
+			block.Add(block, b)
+			sum := block.Bytes()
+			if len(sum) > v {
+				sum = sum[len(sum)-v:]
+			}
+			copy(input[j:j+v], make([]byte, v))
+			copy(input[j+v-len(sum):j+v], sum)
+		}
+	}
+	return out[:size]
+}
+
+// bmpPassword is the UTF-16 big endian password with a terminating zero
+func bmpPassword(password string) []byte {
+	out := []byte{}
+	for _, r := range utf16.Encode([]rune(password)) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return append(out, 0, 0)
+}
+
+func friendlyNameAttribute(name string) pkcs12Attribute {
+	bmp := bmpPassword(name)
+	return pkcs12Attribute{ID: oidFriendlyName, Values: []asn1.RawValue{{Tag: asn1.TagBMPString, Bytes: bmp[:len(bmp)-2]}}}
+}
+
+func explicitTag(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
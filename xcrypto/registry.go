@@ -0,0 +1,152 @@
+package xcrypto
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xfile"
+)
+
+// IssuedRecord describes a certificate issued by a CA
+type IssuedRecord struct {
+	Serial      string    `json:"serial"`
+	Subject     string    `json:"subject"`
+	Names       []string  `json:"names,omitempty"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	Fingerprint string    `json:"fingerprint"`
+	// RevokedAt is set once the certificate was revoked
+	RevokedAt        *time.Time       `json:"revokedAt,omitempty"`
+	RevocationReason RevocationReason `json:"revocationReason,omitempty"`
+}
+
+// SerialRegistry keeps every issued certificate in a json lines file,
+// revocations are appended as updated records and the last record of a serial wins
+type SerialRegistry struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]*IssuedRecord
+}
+
+// OpenSerialRegistry loads the registry from path, the file is created on the first record
+func OpenSerialRegistry(path string) (*SerialRegistry, error) {
+	r := &SerialRegistry{path: path, records: map[string]*IssuedRecord{}}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := &IssuedRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("invalid registry record %s:%d: %v", path, line, err)
+		}
+		r.records[record.Serial] = record
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Record appends the certificate, a serial number can only be recorded once
+func (r *SerialRegistry) Record(cert *x509.Certificate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	serial := serialKey(cert.SerialNumber)
+	if _, ok := r.records[serial]; ok {
+		return fmt.Errorf("xcrypto: serial number %s was already issued", serial)
+	}
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	record := &IssuedRecord{
+		Serial:      serial,
+		Subject:     cert.Subject.String(),
+		Names:       names,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		IssuedAt:    time.Now(),
+		Fingerprint: FingerprintSHA256(cert),
+	}
+	if err := r.append(record); err != nil {
+		return err
+	}
+	r.records[serial] = record
+	return nil
+}
+
+func (r *SerialRegistry) append(record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := xfile.MkdirParent(r.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (r *SerialRegistry) Contains(serial *big.Int) bool {
+	_, ok := r.Get(serial)
+	return ok
+}
+
+func (r *SerialRegistry) Get(serial *big.Int) (IssuedRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[serialKey(serial)]
+	if !ok {
+		return IssuedRecord{}, false
+	}
+	return *record, true
+}
+
+// List returns all records ordered by issue time
+func (r *SerialRegistry) List() []IssuedRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]IssuedRecord, 0, len(r.records))
+	for _, record := range r.records {
+		list = append(list, *record)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].IssuedAt.Before(list[j].IssuedAt) })
+	return list
+}
+
+func serialKey(serial *big.Int) string {
+	return serial.Text(16)
+}
@@ -0,0 +1,258 @@
+package xcrypto
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultReloadInterval = 10 * time.Second
+	DefaultExpiryWarning  = 7 * 24 * time.Hour
+)
+
+// ReloadingCertificate serves a cert/key pair from disk and picks up rotated files without a restart.
+// The files are polled, a new pair replaces the current one only after it was parsed and validated.
+type ReloadingCertificate struct {
+	CertFile   string
+	KeyFile    string
+	Passphrase []byte
+	Interval   time.Duration
+	// ExpiryWarning is how long before NotAfter OnExpiry is called, once per certificate
+	ExpiryWarning time.Duration
+	OnRotate      func(cert *tls.Certificate)
+	// OnError receives failed reloads while the previous pair is kept, they are dropped without it
+	OnError  func(err error)
+	OnExpiry func(leaf *x509.Certificate, remaining time.Duration)
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu      sync.Mutex
+	digest  [sha256.Size]byte
+	warned  *x509.Certificate
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewReloadingCertificate loads the pair once, call Start to watch the files
+func NewReloadingCertificate(certFile, keyFile string, passphrase []byte) (*ReloadingCertificate, error) {
+	c := &ReloadingCertificate{
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		Passphrase:    passphrase,
+		Interval:      DefaultReloadInterval,
+		ExpiryWarning: DefaultExpiryWarning,
+	}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *ReloadingCertificate) SetInterval(interval time.Duration) *ReloadingCertificate {
+	c.Interval = interval
+	return c
+}
+
+func (c *ReloadingCertificate) SetExpiryWarning(warning time.Duration) *ReloadingCertificate {
+	c.ExpiryWarning = warning
+	return c
+}
+
+func (c *ReloadingCertificate) SetOnRotate(onRotate func(cert *tls.Certificate)) *ReloadingCertificate {
+	c.OnRotate = onRotate
+	return c
+}
+
+func (c *ReloadingCertificate) SetOnError(onError func(err error)) *ReloadingCertificate {
+	c.OnError = onError
+	return c
+}
+
+func (c *ReloadingCertificate) SetOnExpiry(onExpiry func(leaf *x509.Certificate, remaining time.Duration)) *ReloadingCertificate {
+	c.OnExpiry = onExpiry
+	return c
+}
+
+// Certificate returns the current pair
+func (c *ReloadingCertificate) Certificate() *tls.Certificate {
+	return c.cert.Load()
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate
+func (c *ReloadingCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate
+func (c *ReloadingCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Reload reads the files and swaps the pair if they changed, it reports whether the pair was replaced.
+// On error the current pair is kept. The callbacks run after the lock is released, so they may call Reload.
+func (c *ReloadingCertificate) Reload() (bool, error) {
+	c.mu.Lock()
+	cert, rotated, err := c.reload()
+	var remaining time.Duration
+	expiring := false
+	if cert != nil {
+		remaining, expiring = c.checkExpiry(cert.Leaf)
+	}
+	c.mu.Unlock()
+	if err != nil || cert == nil {
+		return false, err
+	}
+	if rotated && c.OnRotate != nil {
+		c.OnRotate(cert)
+	}
+	if expiring {
+		c.notifyExpiry(cert.Leaf, remaining)
+	}
+	return true, nil
+}
+
+// reload swaps the pair under c.mu, it returns the new pair or nil if the files are unchanged
+func (c *ReloadingCertificate) reload() (cert *tls.Certificate, rotated bool, err error) {
+	certPEM, err := os.ReadFile(c.CertFile)
+	if err != nil {
+		return nil, false, err
+	}
+	keyPEM, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, false, err
+	}
+	h := sha256.New()
+	h.Write(certPEM)
+	h.Write([]byte{0})
+	h.Write(keyPEM)
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+	if c.cert.Load() != nil && digest == c.digest {
+		return nil, false, nil
+	}
+	cert, err = parseKeyPair(certPEM, keyPEM, c.Passphrase)
+	if err != nil {
+		return nil, false, fmt.Errorf("xcrypto: reload %s: %w", c.CertFile, err)
+	}
+	c.digest = digest
+	old := c.cert.Swap(cert)
+	return cert, old != nil, nil
+}
+
+// Start polls the files every Interval until ctx is done or Stop is called
+func (c *ReloadingCertificate) Start(ctx context.Context) {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	ctx, c.stop = context.WithCancel(ctx)
+	c.stopped = make(chan struct{})
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	stopped := c.stopped
+	c.mu.Unlock()
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastErr string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// a failing pair is reported once until the error changes
+			if _, err := c.Reload(); err == nil {
+				lastErr = ""
+			} else if err.Error() != lastErr {
+				lastErr = err.Error()
+				c.reportError(err)
+			}
+			leaf := c.cert.Load().Leaf
+			c.mu.Lock()
+			remaining, expiring := c.checkExpiry(leaf)
+			c.mu.Unlock()
+			if expiring {
+				c.notifyExpiry(leaf, remaining)
+			}
+		}
+	}()
+}
+
+// Stop ends the polling started by Start and waits for it
+func (c *ReloadingCertificate) Stop() {
+	c.mu.Lock()
+	stop, stopped := c.stop, c.stopped
+	c.stop, c.stopped = nil, nil
+	c.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-stopped
+	}
+}
+
+func (c *ReloadingCertificate) reportError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// checkExpiry reports whether OnExpiry is due for leaf, it must be called with c.mu held
+func (c *ReloadingCertificate) checkExpiry(leaf *x509.Certificate) (time.Duration, bool) {
+	warning := c.ExpiryWarning
+	if warning <= 0 || leaf == nil || leaf == c.warned {
+		return 0, false
+	}
+	remaining := time.Until(leaf.NotAfter)
+	if remaining > warning {
+		return 0, false
+	}
+	c.warned = leaf
+	return remaining, true
+}
+
+func (c *ReloadingCertificate) notifyExpiry(leaf *x509.Certificate, remaining time.Duration) {
+	if c.OnExpiry != nil {
+		c.OnExpiry(leaf, remaining)
+	}
+}
+
+// parseKeyPair validates that the key belongs to the leaf and the leaf is currently valid
+func parseKeyPair(certData, keyData, passphrase []byte) (*tls.Certificate, error) {
+	certs, err := ParseCertificates(certData)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	key, err := ParsePrivateKey(keyData, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certs[0]
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate %s expired at %s", leaf.Subject, leaf.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate %s is not valid before %s", leaf.Subject, leaf.NotBefore.Format(time.RFC3339))
+	}
+	cert, err := X509ToTlsCert(leaf, key, certs[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
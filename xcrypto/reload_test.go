@@ -0,0 +1,139 @@
+package xcrypto
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadingCertificate(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP256})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	write := func(validity time.Duration) *x509.Certificate {
+		key := mustKey(t, ECDSAP256)
+		cert, err := issueLeaf(ca, key, []string{"localhost", "127.0.0.1"}, validity)
+		require.NoError(t, err)
+		require.NoError(t, SaveCertificates(certFile, PEM, cert.Leaf, ca.Cert))
+		require.NoError(t, SavePrivateKey(keyFile, key, PKCS8, nil))
+		return cert.Leaf
+	}
+
+	first := write(DefaultLeafValidity)
+	reloading, err := NewReloadingCertificate(certFile, keyFile, nil)
+	require.NoError(t, err)
+	require.Equal(t, first.Raw, reloading.Certificate().Leaf.Raw)
+	rotated := make(chan *tls.Certificate, 1)
+	expiring := make(chan *x509.Certificate, 1)
+	reloading.SetOnRotate(func(cert *tls.Certificate) { rotated <- cert }).
+		SetOnExpiry(func(leaf *x509.Certificate, remaining time.Duration) { expiring <- leaf }).
+		SetExpiryWarning(24 * time.Hour)
+
+	changed, err := reloading.Reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// a key that does not match keeps the old pair
+	require.NoError(t, SavePrivateKey(keyFile, mustKey(t, ECDSAP256), PKCS8, nil))
+	_, err = reloading.Reload()
+	require.Error(t, err)
+	require.Equal(t, first.Raw, reloading.Certificate().Leaf.Raw)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetCertificate: reloading.GetCertificate}
+	server.StartTLS()
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	client := &http.Client{Transport: &http.Transport{
+		// SNI makes the server prefer GetCertificate over the httptest certificate
+		TLSClientConfig:   &tls.Config{RootCAs: pool, ServerName: "localhost"},
+		DisableKeepAlives: true,
+	}}
+	served := func() *x509.Certificate {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0]
+	}
+	require.Equal(t, first.Raw, served().Raw)
+
+	errs := make(chan error, 8)
+	reloading.SetInterval(10 * time.Millisecond).SetOnError(func(err error) { errs <- err })
+	reloading.Start(context.Background())
+	defer reloading.Stop()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error was not reported")
+	}
+
+	// the second certificate expires within the warning window
+	second := write(time.Hour)
+	select {
+	case cert := <-rotated:
+		require.Equal(t, second.Raw, cert.Leaf.Raw)
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate was not rotated")
+	}
+	select {
+	case leaf := <-expiring:
+		require.Equal(t, second.Raw, leaf.Raw)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expiry warning was not fired")
+	}
+	require.Equal(t, second.Raw, served().Raw)
+	reloading.Stop()
+	require.Len(t, errs, 0)
+}
+
+func TestReloadingCertificateReentrant(t *testing.T) {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: ECDSAP256})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	write := func(validity time.Duration) {
+		key := mustKey(t, ECDSAP256)
+		cert, err := issueLeaf(ca, key, []string{"localhost"}, validity)
+		require.NoError(t, err)
+		require.NoError(t, SaveCertificates(certFile, PEM, cert.Leaf, ca.Cert))
+		require.NoError(t, SavePrivateKey(keyFile, key, PKCS8, nil))
+	}
+
+	write(DefaultLeafValidity)
+	reloading, err := NewReloadingCertificate(certFile, keyFile, nil)
+	require.NoError(t, err)
+	var reloaded, expired []bool
+	reloading.SetOnRotate(func(*tls.Certificate) {
+		changed, _ := reloading.Reload()
+		reloaded = append(reloaded, changed)
+	}).SetOnExpiry(func(*x509.Certificate, time.Duration) {
+		changed, _ := reloading.Reload()
+		expired = append(expired, changed)
+	}).SetExpiryWarning(24 * time.Hour)
+
+	write(time.Hour)
+	var changed bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		changed, err = reloading.Reload()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload from a callback deadlocked")
+	}
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, []bool{false}, reloaded)
+	require.Equal(t, []bool{false}, expired)
+}
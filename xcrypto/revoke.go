@@ -0,0 +1,107 @@
+package xcrypto
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	PEMTypeCRL       = "X509 CRL"
+	DefaultCRLUpdate = time.Hour * 24 * 7
+)
+
+// RevocationReason is the CRLReason of RFC 5280
+type RevocationReason int
+
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+)
+
+// Revoke marks an issued certificate as revoked
+func (r *SerialRegistry) Revoke(serial *big.Int, reason RevocationReason) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := serialKey(serial)
+	record, ok := r.records[key]
+	if !ok {
+		return fmt.Errorf("xcrypto: serial number %s was not issued", key)
+	}
+	if record.RevokedAt != nil {
+		return fmt.Errorf("xcrypto: serial number %s is already revoked", key)
+	}
+	revoked := *record
+	now := time.Now().UTC().Truncate(time.Second)
+	revoked.RevokedAt = &now
+	revoked.RevocationReason = reason
+	if err := r.append(&revoked); err != nil {
+		return err
+	}
+	r.records[key] = &revoked
+	return nil
+}
+
+// Revoked returns the revoked certificates
+func (r *SerialRegistry) Revoked() []IssuedRecord {
+	revoked := []IssuedRecord{}
+	for _, record := range r.List() {
+		if record.RevokedAt != nil {
+			revoked = append(revoked, record)
+		}
+	}
+	return revoked
+}
+
+// Revoke revokes a certificate issued by the CA, the CA requires a registry
+func (ca *CA) Revoke(serial *big.Int, reason RevocationReason) error {
+	if ca.Registry == nil {
+		return errors.New("xcrypto: revocation requires a CA with a serial registry")
+	}
+	return ca.Registry.Revoke(serial, reason)
+}
+
+// CreateCRL returns a DER CRL of all revoked certificates, valid until nextUpdate from now
+func (ca *CA) CreateCRL(nextUpdate time.Duration) ([]byte, error) {
+	if ca.Registry == nil {
+		return nil, errors.New("xcrypto: CRL requires a CA with a serial registry")
+	}
+	if nextUpdate <= 0 {
+		nextUpdate = DefaultCRLUpdate
+	}
+	entries := []x509.RevocationListEntry{}
+	for _, record := range ca.Registry.Revoked() {
+		serial, ok := new(big.Int).SetString(record.Serial, 16)
+		if !ok {
+			return nil, fmt.Errorf("xcrypto: invalid serial number %s in registry", record.Serial)
+		}
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *record.RevokedAt,
+			ReasonCode:     int(record.RevocationReason),
+		})
+	}
+	now := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		// CRL numbers must increase with every CRL
+		Number:     big.NewInt(now.UnixNano()),
+		ThisUpdate: now,
+		NextUpdate: now.Add(nextUpdate),
+	}
+	return x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+}
+
+func EncodeCRL(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeCRL, Bytes: der})
+}
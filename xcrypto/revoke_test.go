@@ -0,0 +1,143 @@
+package xcrypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRevokeCRL(t *testing.T) {
+	ca := createRegistryCA(t, ECDSAP256)
+	good := signLeaf(t, ca, "good.example.com")
+	revoked := signLeaf(t, ca, "revoked.example.com")
+
+	require.NoError(t, ca.Revoke(revoked.SerialNumber, ReasonKeyCompromise))
+	require.Error(t, ca.Revoke(revoked.SerialNumber, ReasonKeyCompromise))
+	require.Error(t, ca.Revoke(mustSerial(t), ReasonUnspecified))
+
+	der, err := ca.CreateCRL(time.Hour)
+	require.NoError(t, err)
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(ca.Cert))
+	require.Len(t, crl.RevokedCertificateEntries, 1)
+	require.Equal(t, 0, crl.RevokedCertificateEntries[0].SerialNumber.Cmp(revoked.SerialNumber))
+	require.Equal(t, int(ReasonKeyCompromise), crl.RevokedCertificateEntries[0].ReasonCode)
+
+	// revocations survive reopening the registry
+	registry, err := OpenSerialRegistry(ca.Registry.path)
+	require.NoError(t, err)
+	record, ok := registry.Get(revoked.SerialNumber)
+	require.True(t, ok)
+	require.NotNil(t, record.RevokedAt)
+	require.Equal(t, ReasonKeyCompromise, record.RevocationReason)
+	record, ok = registry.Get(good.SerialNumber)
+	require.True(t, ok)
+	require.Nil(t, record.RevokedAt)
+	require.Len(t, registry.Revoked(), 1)
+}
+
+func TestOCSPResponder(t *testing.T) {
+	for _, alg := range []KeyAlgorithm{ECDSAP256, ECDSAP384, RSA, Ed25519} {
+		t.Run(alg.String(), func(t *testing.T) {
+			ca := createRegistryCA(t, alg)
+			good := signLeaf(t, ca, "good.example.com")
+			revoked := signLeaf(t, ca, "revoked.example.com")
+			require.NoError(t, ca.Revoke(revoked.SerialNumber, ReasonSuperseded))
+
+			server := httptest.NewServer(NewOCSPResponder(ca))
+			defer server.Close()
+
+			query := func(cert *x509.Certificate, get bool) *ocsp.Response {
+				request, err := ocsp.CreateRequest(cert, ca.Cert, nil)
+				require.NoError(t, err)
+				var resp *http.Response
+				if get {
+					resp, err = http.Get(server.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(request)))
+				} else {
+					resp, err = http.Post(server.URL, OCSPRequestContentType, bytes.NewReader(request))
+				}
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				require.Equal(t, OCSPResponseContentType, resp.Header.Get("Content-Type"))
+				data, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				issuer := ca.Cert
+				if alg == Ed25519 {
+					// x/crypto/ocsp cannot verify Ed25519 signatures
+					issuer = nil
+				}
+				parsed, err := ocsp.ParseResponseForCert(data, cert, issuer)
+				require.NoError(t, err)
+				if issuer == nil {
+					require.True(t, ed25519.Verify(ca.Key.Public().(ed25519.PublicKey), parsed.TBSResponseData, parsed.Signature))
+				}
+				require.Equal(t, 0, parsed.SerialNumber.Cmp(cert.SerialNumber))
+				require.True(t, parsed.NextUpdate.After(parsed.ThisUpdate))
+				return parsed
+			}
+
+			require.Equal(t, ocsp.Good, query(good, false).Status)
+			require.Equal(t, ocsp.Good, query(good, true).Status)
+			response := query(revoked, false)
+			require.Equal(t, ocsp.Revoked, response.Status)
+			require.Equal(t, ocsp.Superseded, response.RevocationReason)
+
+			unknown := signTemplate(t, ca, &x509.Certificate{
+				SerialNumber: mustSerial(t),
+				Subject:      pkix.Name{CommonName: "unknown.example.com"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+			})
+			require.Equal(t, ocsp.Unknown, query(unknown, false).Status)
+		})
+	}
+}
+
+func TestOCSPResponderErrors(t *testing.T) {
+	ca := createRegistryCA(t, ECDSAP256)
+	responder := NewOCSPResponder(ca)
+
+	_, err := ocsp.ParseResponse(responder.Respond([]byte("garbage")), nil)
+	require.Equal(t, ocsp.ResponseError{Status: ocsp.Malformed}, err)
+
+	// certificates of another issuer are not answered
+	other := createRegistryCA(t, ECDSAP256)
+	leaf := signLeaf(t, other, "other.example.com")
+	request, err := ocsp.CreateRequest(leaf, other.Cert, nil)
+	require.NoError(t, err)
+	_, err = ocsp.ParseResponse(responder.Respond(request), nil)
+	require.Equal(t, ocsp.ResponseError{Status: ocsp.Unauthorized}, err)
+
+	recorder := httptest.NewRecorder()
+	responder.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func createRegistryCA(t *testing.T, alg KeyAlgorithm) *CA {
+	ca, err := CreateCA(&CAOptions{KeyAlgorithm: alg})
+	require.NoError(t, err)
+	ca.Registry, err = OpenSerialRegistry(filepath.Join(t.TempDir(), "serials.jsonl"))
+	require.NoError(t, err)
+	return ca
+}
+
+func signLeaf(t *testing.T, ca *CA, name string) *x509.Certificate {
+	csr, err := CreateCSR(mustKey(t, ECDSAP256), &CSROptions{DNSNames: []string{name}})
+	require.NoError(t, err)
+	cert, err := ca.Sign(csr, nil)
+	require.NoError(t, err)
+	return cert
+}
@@ -0,0 +1,377 @@
+package xcrypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySize is the key size of all ciphers
+const KeySize = 32
+
+// Cipher is the AEAD of an envelope
+type Cipher byte
+
+const (
+	AES256GCM        Cipher = 1
+	ChaCha20Poly1305 Cipher = 2
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case AES256GCM:
+		return "AES-256-GCM"
+	case ChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	default:
+		return fmt.Sprintf("Cipher(%d)", byte(c))
+	}
+}
+
+// KDF derives envelope keys from passwords
+type KDF byte
+
+const (
+	KDFNone         KDF = 0
+	KDFScrypt       KDF = 1
+	KDFArgon2id     KDF = 2
+	KDFPBKDF2SHA256 KDF = 3
+)
+
+// KDFParams configure a KDF, fields of other KDFs are ignored
+type KDFParams struct {
+	KDF KDF
+	// ScryptN must be a power of two
+	ScryptN, ScryptR, ScryptP uint32
+	// ArgonMemory is in KiB
+	ArgonTime, ArgonMemory uint32
+	ArgonThreads           uint8
+	// Iterations of PBKDF2, defaults to PBKDF2Iterations
+	Iterations uint32
+}
+
+var (
+	DefaultScrypt   = KDFParams{KDF: KDFScrypt, ScryptN: 1 << 15, ScryptR: 8, ScryptP: 1}
+	DefaultArgon2id = KDFParams{KDF: KDFArgon2id, ArgonTime: 3, ArgonMemory: 64 * 1024, ArgonThreads: 4}
+)
+
+// limits on KDF parameters, so a forged header or password hash cannot exhaust memory or cpu
+const (
+	maxScryptMemory  = 256 << 20 // bytes, 128*N*r*p
+	maxArgonMemory   = 1 << 20   // KiB
+	maxArgonTime     = 64
+	maxKDFIterations = 10_000_000
+	saltSize         = 16
+	nonceSize        = 12
+	envelopeVersion  = 1
+	modeSealed       = 0
+	modeStream       = 1
+)
+
+var (
+	envelopeMagic = []byte("xce")
+
+	ErrInvalidEnvelope = errors.New("xcrypto: invalid envelope")
+	// ErrDecrypt is returned for a wrong key or password and for tampered data
+	ErrDecrypt = errors.New("xcrypto: message authentication failed")
+)
+
+// Secret is the key material of an envelope, a raw key or a password
+type Secret struct {
+	key      []byte
+	password []byte
+	kdf      KDFParams
+}
+
+// RawKey uses a random key of KeySize bytes
+func RawKey(key []byte) Secret {
+	return Secret{key: key}
+}
+
+// PasswordKey stretches a password, the KDF is only used to encrypt and defaults to Argon2id
+func PasswordKey(password []byte, kdf *KDFParams) Secret {
+	params := DefaultArgon2id
+	if kdf != nil {
+		params = *kdf
+	}
+	return Secret{password: password, kdf: params}
+}
+
+// NewRandomKey returns a random key of KeySize bytes
+func NewRandomKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// envelopeHeader is authenticated as additional data of every sealed message
+type envelopeHeader struct {
+	cipher    Cipher
+	kdf       KDFParams
+	salt      []byte
+	mode      byte
+	chunkSize uint32
+	nonce     []byte
+}
+
+func newEnvelopeHeader(secret Secret, c Cipher, mode byte, chunkSize uint32) (*envelopeHeader, error) {
+	if c != AES256GCM && c != ChaCha20Poly1305 {
+		return nil, fmt.Errorf("xcrypto: unsupported cipher %v", c)
+	}
+	h := &envelopeHeader{cipher: c, mode: mode, chunkSize: chunkSize}
+	if secret.password != nil {
+		h.kdf = secret.kdf
+		if h.kdf.KDF == KDFNone {
+			return nil, errors.New("xcrypto: password requires a KDF")
+		}
+		if h.kdf.KDF == KDFPBKDF2SHA256 && h.kdf.Iterations == 0 {
+			h.kdf.Iterations = uint32(PBKDF2Iterations)
+		}
+		// envelopes beyond the limits could not be opened again
+		if err := h.kdf.checkLimits(); err != nil {
+			return nil, err
+		}
+		h.salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, h.salt); err != nil {
+			return nil, err
+		}
+	}
+	// streams count chunks in the last 5 bytes of the nonce
+	size := nonceSize
+	if mode == modeStream {
+		size = nonceSize - 5
+	}
+	h.nonce = make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, h.nonce); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *envelopeHeader) marshal() []byte {
+	var b bytes.Buffer
+	b.Write(envelopeMagic)
+	b.WriteByte(envelopeVersion)
+	b.WriteByte(byte(h.cipher))
+	b.WriteByte(byte(h.kdf.KDF))
+	if h.kdf.KDF != KDFNone {
+		p1, p2, p3 := h.kdf.encode()
+		binary.Write(&b, binary.BigEndian, [3]uint32{p1, p2, p3})
+		b.WriteByte(byte(len(h.salt)))
+		b.Write(h.salt)
+	}
+	b.WriteByte(h.mode)
+	if h.mode == modeStream {
+		binary.Write(&b, binary.BigEndian, h.chunkSize)
+	}
+	b.Write(h.nonce)
+	return b.Bytes()
+}
+
+// readEnvelopeHeader parses a header and returns its raw bytes for authentication
+func readEnvelopeHeader(r io.Reader) (*envelopeHeader, []byte, error) {
+	var raw bytes.Buffer
+	r = io.TeeReader(r, &raw)
+	fixed := make([]byte, len(envelopeMagic)+3)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	if !bytes.Equal(fixed[:len(envelopeMagic)], envelopeMagic) || fixed[len(envelopeMagic)] != envelopeVersion {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	h := &envelopeHeader{cipher: Cipher(fixed[4]), kdf: KDFParams{KDF: KDF(fixed[5])}}
+	if h.cipher != AES256GCM && h.cipher != ChaCha20Poly1305 {
+		return nil, nil, fmt.Errorf("xcrypto: unsupported cipher %v", h.cipher)
+	}
+	if h.kdf.KDF != KDFNone {
+		var params [3]uint32
+		if err := binary.Read(r, binary.BigEndian, &params); err != nil {
+			return nil, nil, ErrInvalidEnvelope
+		}
+		if err := h.kdf.decode(params[0], params[1], params[2]); err != nil {
+			return nil, nil, err
+		}
+		var size [1]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, nil, ErrInvalidEnvelope
+		}
+		h.salt = make([]byte, size[0])
+		if _, err := io.ReadFull(r, h.salt); err != nil {
+			return nil, nil, ErrInvalidEnvelope
+		}
+	}
+	var mode [1]byte
+	if _, err := io.ReadFull(r, mode[:]); err != nil {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	h.mode = mode[0]
+	size := nonceSize
+	switch h.mode {
+	case modeSealed:
+	case modeStream:
+		if err := binary.Read(r, binary.BigEndian, &h.chunkSize); err != nil || h.chunkSize == 0 || h.chunkSize > maxChunkSize {
+			return nil, nil, ErrInvalidEnvelope
+		}
+		size = nonceSize - 5
+	default:
+		return nil, nil, ErrInvalidEnvelope
+	}
+	h.nonce = make([]byte, size)
+	if _, err := io.ReadFull(r, h.nonce); err != nil {
+		return nil, nil, ErrInvalidEnvelope
+	}
+	return h, raw.Bytes(), nil
+}
+
+func (p *KDFParams) encode() (uint32, uint32, uint32) {
+	switch p.KDF {
+	case KDFScrypt:
+		return p.ScryptN, p.ScryptR, p.ScryptP
+	case KDFArgon2id:
+		return p.ArgonTime, p.ArgonMemory, uint32(p.ArgonThreads)
+	default:
+		return p.Iterations, 0, 0
+	}
+}
+
+func (p *KDFParams) decode(p1, p2, p3 uint32) error {
+	switch p.KDF {
+	case KDFScrypt:
+		p.ScryptN, p.ScryptR, p.ScryptP = p1, p2, p3
+	case KDFArgon2id:
+		if p3 > 255 {
+			return fmt.Errorf("xcrypto: argon2id parameters exceed limits")
+		}
+		p.ArgonTime, p.ArgonMemory, p.ArgonThreads = p1, p2, uint8(p3)
+	case KDFPBKDF2SHA256:
+		p.Iterations = p1
+	default:
+		return fmt.Errorf("xcrypto: unsupported KDF %d", p.KDF)
+	}
+	return p.checkLimits()
+}
+
+// checkLimits rejects parameters that need more than maxScryptMemory or maxArgonMemory, or too many passes
+func (p *KDFParams) checkLimits() error {
+	switch p.KDF {
+	case KDFScrypt:
+		memory := uint64(128)
+		for _, factor := range []uint32{p.ScryptN, p.ScryptR, p.ScryptP} {
+			if factor == 0 || uint64(factor) > maxScryptMemory/memory {
+				return fmt.Errorf("xcrypto: scrypt parameters exceed limits")
+			}
+			memory *= uint64(factor)
+		}
+	case KDFArgon2id:
+		if p.ArgonMemory > maxArgonMemory || p.ArgonTime > maxArgonTime {
+			return fmt.Errorf("xcrypto: argon2id parameters exceed limits")
+		}
+	case KDFPBKDF2SHA256:
+		if p.Iterations > maxKDFIterations {
+			return fmt.Errorf("xcrypto: pbkdf2 parameters exceed limits")
+		}
+	}
+	return nil
+}
+
+// DeriveKey stretches a password into a key of KeySize bytes
+func DeriveKey(password, salt []byte, params KDFParams) ([]byte, error) {
+	return deriveKey(password, salt, params, KeySize)
+}
+
+func deriveKey(password, salt []byte, params KDFParams, size int) ([]byte, error) {
+	switch params.KDF {
+	case KDFScrypt:
+		return scrypt.Key(password, salt, int(params.ScryptN), int(params.ScryptR), int(params.ScryptP), size)
+	case KDFArgon2id:
+		if params.ArgonTime == 0 || params.ArgonMemory == 0 || params.ArgonThreads == 0 {
+			return nil, errors.New("xcrypto: invalid argon2id parameters")
+		}
+		return argon2.IDKey(password, salt, params.ArgonTime, params.ArgonMemory, params.ArgonThreads, uint32(size)), nil
+	case KDFPBKDF2SHA256:
+		if params.Iterations == 0 {
+			return nil, errors.New("xcrypto: invalid pbkdf2 iterations")
+		}
+		return pbkdf2.Key(password, salt, int(params.Iterations), size, sha256.New), nil
+	default:
+		return nil, fmt.Errorf("xcrypto: unsupported KDF %d", params.KDF)
+	}
+}
+
+func (h *envelopeHeader) aead(secret Secret) (cipher.AEAD, error) {
+	key := secret.key
+	switch {
+	case h.kdf.KDF != KDFNone && secret.password == nil:
+		return nil, errors.New("xcrypto: envelope is encrypted with a password")
+	case h.kdf.KDF == KDFNone && secret.password != nil:
+		return nil, errors.New("xcrypto: envelope is encrypted with a raw key")
+	case h.kdf.KDF != KDFNone:
+		derived, err := DeriveKey(secret.password, h.salt, h.kdf)
+		if err != nil {
+			return nil, err
+		}
+		key = derived
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("xcrypto: key must be %d bytes", KeySize)
+	}
+	if h.cipher == ChaCha20Poly1305 {
+		return chacha20poly1305.New(key)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts and authenticates plaintext and additionalData into a self-describing envelope
+func Seal(secret Secret, c Cipher, plaintext, additionalData []byte) ([]byte, error) {
+	h, err := newEnvelopeHeader(secret, c, modeSealed, 0)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	header := h.marshal()
+	return aead.Seal(header, h.nonce, plaintext, concat(header, additionalData)), nil
+}
+
+// Open decrypts an envelope of Seal, additionalData must be the same as for Seal
+func Open(secret Secret, envelope, additionalData []byte) ([]byte, error) {
+	h, header, err := readEnvelopeHeader(bytes.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+	if h.mode != modeSealed {
+		return nil, errors.New("xcrypto: envelope is a stream, use NewDecryptReader")
+	}
+	aead, err := h.aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, h.nonce, envelope[len(header):], concat(header, additionalData))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func concat(a, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
+}
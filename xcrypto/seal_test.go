@@ -0,0 +1,180 @@
+package xcrypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// cheap parameters keep the tests fast
+var testKDFs = []KDFParams{
+	{KDF: KDFScrypt, ScryptN: 1 << 10, ScryptR: 8, ScryptP: 1},
+	{KDF: KDFArgon2id, ArgonTime: 1, ArgonMemory: 1024, ArgonThreads: 1},
+	{KDF: KDFPBKDF2SHA256, Iterations: 1000},
+}
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewRandomKey()
+	require.NoError(t, err)
+	plaintext := []byte("database password")
+	for _, c := range []Cipher{AES256GCM, ChaCha20Poly1305} {
+		envelope, err := Seal(RawKey(key), c, plaintext, []byte("config"))
+		require.NoError(t, err)
+		opened, err := Open(RawKey(key), envelope, []byte("config"))
+		require.NoError(t, err, c.String())
+		require.Equal(t, plaintext, opened)
+
+		_, err = Open(RawKey(key), envelope, []byte("other"))
+		require.ErrorIs(t, err, ErrDecrypt)
+		other, err := NewRandomKey()
+		require.NoError(t, err)
+		_, err = Open(RawKey(other), envelope, []byte("config"))
+		require.ErrorIs(t, err, ErrDecrypt)
+		_, err = Open(PasswordKey([]byte("secret"), nil), envelope, []byte("config"))
+		require.Error(t, err)
+
+		// the header is authenticated
+		tampered := append([]byte{}, envelope...)
+		tampered[4] = byte(AES256GCM + ChaCha20Poly1305 - c)
+		_, err = Open(RawKey(key), tampered, []byte("config"))
+		require.ErrorIs(t, err, ErrDecrypt)
+		_, err = Open(RawKey(key), envelope[:10], nil)
+		require.Error(t, err)
+	}
+	_, err = Seal(RawKey(key[:16]), AES256GCM, plaintext, nil)
+	require.Error(t, err)
+	_, err = Seal(RawKey(key), Cipher(9), plaintext, nil)
+	require.Error(t, err)
+}
+
+func TestSealPassword(t *testing.T) {
+	for _, kdf := range testKDFs {
+		envelope, err := Seal(PasswordKey([]byte("secret"), &kdf), ChaCha20Poly1305, []byte("hello"), nil)
+		require.NoError(t, err)
+		opened, err := Open(PasswordKey([]byte("secret"), nil), envelope, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), opened)
+		_, err = Open(PasswordKey([]byte("wrong"), nil), envelope, nil)
+		require.ErrorIs(t, err, ErrDecrypt)
+		_, err = Open(RawKey(make([]byte, KeySize)), envelope, nil)
+		require.Error(t, err)
+	}
+	_, err := Seal(PasswordKey([]byte("secret"), &KDFParams{}), AES256GCM, nil, nil)
+	require.Error(t, err)
+}
+
+func TestForgedKDFParams(t *testing.T) {
+	for _, kdf := range []KDFParams{
+		{KDF: KDFScrypt, ScryptN: 1 << 22, ScryptR: 1 << 10, ScryptP: 1},
+		{KDF: KDFScrypt, ScryptN: 1 << 15, ScryptR: 8, ScryptP: 1 << 10},
+		{KDF: KDFScrypt, ScryptN: 1 << 31, ScryptR: 1 << 31, ScryptP: 1 << 31},
+		{KDF: KDFArgon2id, ArgonTime: 1, ArgonMemory: 4 << 20, ArgonThreads: 1},
+		{KDF: KDFArgon2id, ArgonTime: 50_000_000, ArgonMemory: 64, ArgonThreads: 1},
+		{KDF: KDFPBKDF2SHA256, Iterations: 50_000_000},
+	} {
+		for _, mode := range []byte{modeSealed, modeStream} {
+			h := &envelopeHeader{cipher: AES256GCM, kdf: kdf, salt: make([]byte, saltSize), mode: mode, chunkSize: 64, nonce: make([]byte, nonceSize)}
+			if mode == modeStream {
+				h.nonce = h.nonce[:nonceSize-5]
+			}
+			envelope := append(h.marshal(), make([]byte, 32)...)
+			if mode == modeSealed {
+				_, err := Open(PasswordKey([]byte("secret"), nil), envelope, nil)
+				require.ErrorContains(t, err, "exceed limits")
+			} else {
+				_, err := NewDecryptReader(bytes.NewReader(envelope), PasswordKey([]byte("secret"), nil))
+				require.ErrorContains(t, err, "exceed limits")
+			}
+		}
+		_, err := Seal(PasswordKey([]byte("secret"), &kdf), AES256GCM, nil, nil)
+		require.Error(t, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	key, err := NewRandomKey()
+	require.NoError(t, err)
+	const chunk = 64
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3 * chunk, 3*chunk + 5} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		var encrypted bytes.Buffer
+		w, err := NewEncryptWriter(&encrypted, RawKey(key), AES256GCM, chunk)
+		require.NoError(t, err)
+		// odd write sizes cross chunk boundaries
+		for rest := plaintext; len(rest) > 0; {
+			n := min(len(rest), 7)
+			_, err := w.Write(rest[:n])
+			require.NoError(t, err)
+			rest = rest[n:]
+		}
+		require.NoError(t, w.Close())
+		requireDecrypts(t, encrypted.Bytes(), RawKey(key), plaintext)
+
+		r, err := NewEncryptReader(bytes.NewReader(plaintext), RawKey(key), ChaCha20Poly1305, chunk)
+		require.NoError(t, err)
+		streamed, err := io.ReadAll(r)
+		require.NoError(t, err)
+		requireDecrypts(t, streamed, RawKey(key), plaintext)
+
+		// dropping the last chunk or appending data is detected
+		if size > chunk {
+			_, err = readAllDecrypted(streamed[:len(streamed)-(size%chunk+16)], RawKey(key))
+			require.ErrorIs(t, err, ErrDecrypt)
+		}
+		_, err = readAllDecrypted(append(streamed, 0), RawKey(key))
+		require.ErrorIs(t, err, ErrDecrypt)
+	}
+
+	envelope, err := Seal(RawKey(key), AES256GCM, []byte("x"), nil)
+	require.NoError(t, err)
+	_, err = NewDecryptReader(bytes.NewReader(envelope), RawKey(key))
+	require.Error(t, err)
+}
+
+func TestEncryptFile(t *testing.T) {
+	dir := t.TempDir()
+	src, enc, dst := filepath.Join(dir, "plain"), filepath.Join(dir, "enc"), filepath.Join(dir, "dst")
+	plaintext := bytes.Repeat([]byte("cache line\n"), 20000)
+	require.NoError(t, os.WriteFile(src, plaintext, 0644))
+	secret := PasswordKey([]byte("secret"), &testKDFs[0])
+	require.NoError(t, EncryptFile(src, enc, secret, AES256GCM))
+	require.NoError(t, DecryptFile(enc, dst, secret))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, data)
+
+	encrypted, err := os.ReadFile(enc)
+	require.NoError(t, err)
+	encrypted[len(encrypted)/2] ^= 1
+	require.NoError(t, os.WriteFile(enc, encrypted, 0644))
+	require.ErrorIs(t, DecryptFile(enc, dst, secret), ErrDecrypt)
+	data, err = os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, data)
+	fresh := filepath.Join(dir, "fresh")
+	require.ErrorIs(t, DecryptFile(enc, fresh, secret), ErrDecrypt)
+	require.NoFileExists(t, fresh)
+}
+
+func requireDecrypts(t *testing.T, encrypted []byte, secret Secret, plaintext []byte) {
+	decrypted, err := readAllDecrypted(encrypted, secret)
+	require.NoError(t, err)
+	require.Equal(t, len(plaintext), len(decrypted))
+	require.True(t, bytes.Equal(plaintext, decrypted))
+}
+
+func readAllDecrypted(encrypted []byte, secret Secret) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), secret)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
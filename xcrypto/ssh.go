@@ -0,0 +1,322 @@
+package xcrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultSSHRSABits matches ssh-keygen
+const DefaultSSHRSABits = 3072
+
+// SSHKeyPair is a private key with its OpenSSH public key
+type SSHKeyPair struct {
+	Private crypto.Signer
+	Public  ssh.PublicKey
+	Comment string
+}
+
+// GenerateSSHKey creates a key pair, rsaBits is only used for RSA and defaults to 3072
+func GenerateSSHKey(alg KeyAlgorithm, rsaBits int, comment string) (*SSHKeyPair, error) {
+	if alg == RSA && rsaBits <= 0 {
+		rsaBits = DefaultSSHRSABits
+	}
+	key, err := GenerateKey(alg, rsaBits)
+	if err != nil {
+		return nil, err
+	}
+	return NewSSHKeyPair(key, comment)
+}
+
+func NewSSHKeyPair(key crypto.Signer, comment string) (*SSHKeyPair, error) {
+	public, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &SSHKeyPair{Private: key, Public: public, Comment: comment}, nil
+}
+
+// EncodePrivateKey returns the "OPENSSH PRIVATE KEY" PEM, encrypted with bcrypt and aes256-ctr for a passphrase
+func (k *SSHKeyPair) EncodePrivateKey(passphrase []byte) ([]byte, error) {
+	var block *pem.Block
+	var err error
+	if len(passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(k.Private, k.Comment, passphrase)
+	} else {
+		block, err = ssh.MarshalPrivateKey(k.Private, k.Comment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// AuthorizedKey returns an authorized_keys line without a line break
+func (k *SSHKeyPair) AuthorizedKey() string {
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(k.Public)), "\n")
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return line
+}
+
+func (k *SSHKeyPair) Fingerprint() string {
+	return ssh.FingerprintSHA256(k.Public)
+}
+
+// Save writes the private key readable only by the owner and the public key to path.pub like ssh-keygen
+func (k *SSHKeyPair) Save(path string, passphrase []byte) error {
+	data, err := k.EncodePrivateKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(path, data, 0600); err != nil {
+		return err
+	}
+	return writeFile(path+".pub", []byte(k.AuthorizedKey()+"\n"), 0644)
+}
+
+// ParseSSHPrivateKey parses OpenSSH, PKCS#1, PKCS#8 and SEC 1 keys, the comment is not restored
+func ParseSSHPrivateKey(data []byte, passphrase []byte) (*SSHKeyPair, error) {
+	var key any
+	var err error
+	if len(passphrase) > 0 {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			err = ErrIncorrectPassphrase
+		}
+	} else {
+		key, err = ssh.ParseRawPrivateKey(data)
+	}
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, errors.New("xcrypto: private key is encrypted, a passphrase is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		return NewSSHKeyPair(*k, "")
+	case ed25519.PrivateKey, *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return NewSSHKeyPair(k.(crypto.Signer), "")
+	}
+	return nil, fmt.Errorf("xcrypto: unsupported SSH private key type %T", key)
+}
+
+// LoadSSHKeyPair loads a private key and takes the comment from path.pub when it exists
+func LoadSSHKeyPair(path string, passphrase []byte) (*SSHKeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := ParseSSHPrivateKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", path, err)
+	}
+	if pub, err := os.ReadFile(path + ".pub"); err == nil {
+		if key, comment, _, _, err := ssh.ParseAuthorizedKey(pub); err == nil && bytes.Equal(key.Marshal(), pair.Public.Marshal()) {
+			pair.Comment = comment
+		}
+	}
+	return pair, nil
+}
+
+// SSHFingerprintLine formats a key like ssh-keygen -l, e.g. "256 SHA256:... user@host (ED25519)"
+func SSHFingerprintLine(key ssh.PublicKey, comment string) string {
+	if comment == "" {
+		comment = "no comment"
+	}
+	return fmt.Sprintf("%d %s %s (%s)", sshKeyBits(key), ssh.FingerprintSHA256(key), comment, sshKeyType(key))
+}
+
+func sshKeyBits(key ssh.PublicKey) int {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	crypted, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	switch k := crypted.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+func sshKeyType(key ssh.PublicKey) string {
+	suffix := ""
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key, suffix = cert.Key, "-CERT"
+	}
+	name := key.Type()
+	switch {
+	case name == ssh.KeyAlgoRSA:
+		name = "RSA"
+	case name == ssh.KeyAlgoDSA:
+		name = "DSA"
+	case name == ssh.KeyAlgoED25519:
+		name = "ED25519"
+	case name == ssh.KeyAlgoSKED25519:
+		name = "ED25519-SK"
+	case name == ssh.KeyAlgoSKECDSA256:
+		name = "ECDSA-SK"
+	case strings.HasPrefix(name, "ecdsa-"):
+		name = "ECDSA"
+	}
+	return name + suffix
+}
+
+// AuthorizedKey is an authorized_keys entry, Line counts from 1
+type AuthorizedKey struct {
+	Key     ssh.PublicKey
+	Comment string
+	Options []string
+	Line    int
+}
+
+// ParseAuthorizedKeys skips blank and comment lines and fails on invalid entries
+func ParseAuthorizedKeys(data []byte) ([]AuthorizedKey, error) {
+	keys := []AuthorizedKey{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, comment, options, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("xcrypto: authorized_keys line %d: %w", i+1, err)
+		}
+		keys = append(keys, AuthorizedKey{Key: key, Comment: comment, Options: options, Line: i + 1})
+	}
+	return keys, nil
+}
+
+// KnownHost is a known_hosts entry, Marker is empty, "@cert-authority" or "@revoked"
+type KnownHost struct {
+	Marker  string
+	Hosts   []string
+	Key     ssh.PublicKey
+	Comment string
+	Line    int
+}
+
+func ParseKnownHosts(data []byte) ([]KnownHost, error) {
+	hosts := []KnownHost{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		marker, names, key, comment, _, err := ssh.ParseKnownHosts(line)
+		if err != nil {
+			return nil, fmt.Errorf("xcrypto: known_hosts line %d: %w", i+1, err)
+		}
+		if marker != "" {
+			marker = "@" + marker
+		}
+		hosts = append(hosts, KnownHost{Marker: marker, Hosts: names, Key: key, Comment: comment, Line: i + 1})
+	}
+	return hosts, nil
+}
+
+// Match reports whether the entry covers a host or host:port, hashed names, wildcards and negations are supported
+func (h *KnownHost) Match(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "22"
+	}
+	host = strings.ToLower(host)
+	normalized := knownhosts.Normalize(net.JoinHostPort(host, port))
+	matched := false
+	for _, pattern := range h.Hosts {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		var ok bool
+		if strings.HasPrefix(pattern, "|1|") {
+			ok = matchHashedHost(pattern, normalized)
+		} else {
+			ok = wildcardMatch(strings.ToLower(pattern), normalized)
+		}
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// KnownHostLine returns a known_hosts line for the addresses, hashed like ssh-keygen -H
+func KnownHostLine(addresses []string, key ssh.PublicKey, hashed bool) string {
+	if !hashed {
+		return knownhosts.Line(addresses, key)
+	}
+	names := make([]string, len(addresses))
+	for i, address := range addresses {
+		names[i] = knownhosts.HashHostname(knownhosts.Normalize(address))
+	}
+	return strings.Join(names, ",") + " " + strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(key)), "\n")
+}
+
+func matchHashedHost(pattern, host string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// wildcardMatch supports * and ? like OpenSSH host patterns
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,151 @@
+package xcrypto
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func sshKeygen(t *testing.T, args ...string) string {
+	path, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	out, err := exec.Command(path, args...).CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestGenerateSSHKey(t *testing.T) {
+	for _, alg := range []KeyAlgorithm{Ed25519, ECDSAP256, ECDSAP384, RSA} {
+		pair, err := GenerateSSHKey(alg, 0, "deploy@example.com")
+		require.NoError(t, err, alg)
+		require.True(t, strings.HasPrefix(pair.Fingerprint(), "SHA256:"))
+		require.True(t, strings.HasSuffix(pair.AuthorizedKey(), " deploy@example.com"))
+
+		// the key signs for an ssh server
+		signer, err := ssh.NewSignerFromKey(pair.Private)
+		require.NoError(t, err)
+		sig, err := signer.Sign(nil, []byte("data"))
+		require.NoError(t, err)
+		require.NoError(t, pair.Public.Verify([]byte("data"), sig))
+
+		for _, passphrase := range [][]byte{nil, []byte("secret")} {
+			path := filepath.Join(t.TempDir(), "id")
+			require.NoError(t, pair.Save(path, passphrase))
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+			loaded, err := LoadSSHKeyPair(path, passphrase)
+			require.NoError(t, err)
+			require.Equal(t, pair.AuthorizedKey(), loaded.AuthorizedKey())
+			require.True(t, PublicKeyEqual(pair.Private.Public(), loaded.Private.Public()))
+			if passphrase != nil {
+				_, err = LoadSSHKeyPair(path, []byte("wrong"))
+				require.ErrorIs(t, err, ErrIncorrectPassphrase)
+				_, err = LoadSSHKeyPair(path, nil)
+				require.Error(t, err)
+			}
+
+			// ssh-keygen reads the private key and prints the same fingerprint
+			require.Equal(t, strings.Fields(pair.AuthorizedKey())[:2],
+				strings.Fields(sshKeygen(t, "-y", "-P", string(passphrase), "-f", path))[:2])
+			require.Equal(t, SSHFingerprintLine(pair.Public, pair.Comment), sshKeygen(t, "-l", "-f", path+".pub"))
+		}
+	}
+	_, err := GenerateSSHKey(KeyAlgorithm(99), 0, "")
+	require.Error(t, err)
+}
+
+func TestParseSSHKeygenKeys(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{{"-t", "ed25519"}, {"-t", "ecdsa", "-b", "521"}, {"-t", "rsa", "-b", "2048"}, {"-t", "rsa", "-b", "2048", "-m", "PEM"}} {
+		path := filepath.Join(dir, strings.Join(args, ""))
+		sshKeygen(t, append(args, "-q", "-N", "passphrase", "-C", "generated", "-f", path)...)
+		pair, err := LoadSSHKeyPair(path, []byte("passphrase"))
+		require.NoError(t, err, args)
+		require.Equal(t, "generated", pair.Comment)
+		require.Equal(t, sshKeygen(t, "-l", "-f", path+".pub"), SSHFingerprintLine(pair.Public, pair.Comment))
+	}
+	pair, err := GenerateSSHKey(Ed25519, 0, "")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(SSHFingerprintLine(pair.Public, ""), " no comment (ED25519)"))
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	first, err := GenerateSSHKey(Ed25519, 0, "alice@laptop")
+	require.NoError(t, err)
+	second, err := GenerateSSHKey(ECDSAP256, 0, "")
+	require.NoError(t, err)
+	data := "# keys\n\n" + first.AuthorizedKey() + "\n" +
+		`command="uptime",no-pty,from="10.0.0.0/8" ` + second.AuthorizedKey() + "\r\n"
+	keys, err := ParseAuthorizedKeys([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, "alice@laptop", keys[0].Comment)
+	require.Equal(t, 3, keys[0].Line)
+	require.Equal(t, first.Fingerprint(), ssh.FingerprintSHA256(keys[0].Key))
+	require.Equal(t, []string{`command="uptime"`, "no-pty", `from="10.0.0.0/8"`}, keys[1].Options)
+	require.Equal(t, second.Fingerprint(), ssh.FingerprintSHA256(keys[1].Key))
+
+	_, err = ParseAuthorizedKeys([]byte(first.AuthorizedKey() + "\nssh-ed25519 AAAAinvalid\n"))
+	require.ErrorContains(t, err, "line 2")
+}
+
+func TestParseKnownHosts(t *testing.T) {
+	host, err := GenerateSSHKey(Ed25519, 0, "")
+	require.NoError(t, err)
+	ca, err := GenerateSSHKey(ECDSAP256, 0, "")
+	require.NoError(t, err)
+	hashed := KnownHostLine([]string{"secret.example.com:2222"}, host.Public, true)
+	require.True(t, strings.HasPrefix(hashed, "|1|"))
+	data := strings.Join([]string{
+		"# known hosts",
+		KnownHostLine([]string{"github.com", "140.82.121.4"}, host.Public, false),
+		hashed,
+		"*.internal,!db.internal " + host.AuthorizedKey() + " wildcard",
+		"@cert-authority *.example.org " + ca.AuthorizedKey(),
+	}, "\n")
+
+	// ssh-keygen finds the hashed host
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(path, []byte(data+"\n"), 0600))
+	require.Contains(t, sshKeygen(t, "-F", "[secret.example.com]:2222", "-f", path), "|1|")
+
+	hosts, err := ParseKnownHosts([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, hosts, 4)
+	require.Equal(t, []string{"github.com", "140.82.121.4"}, hosts[0].Hosts)
+	require.Equal(t, 2, hosts[0].Line)
+	require.Equal(t, host.Fingerprint(), ssh.FingerprintSHA256(hosts[0].Key))
+	require.Equal(t, "wildcard", hosts[2].Comment)
+	require.Equal(t, "@cert-authority", hosts[3].Marker)
+
+	for _, check := range []struct {
+		entry   int
+		address string
+		match   bool
+	}{
+		{0, "github.com", true},
+		{0, "GitHub.com:22", true},
+		{0, "github.com:2222", false},
+		{0, "140.82.121.4", true},
+		{1, "secret.example.com:2222", true},
+		{1, "secret.example.com", false},
+		{2, "web.internal", true},
+		{2, "db.internal", false},
+		{2, "internal", false},
+		{3, "a.example.org", true},
+	} {
+		require.Equal(t, check.match, hosts[check.entry].Match(check.address), check.address)
+	}
+
+	_, err = ParseKnownHosts([]byte("github.com ssh-ed25519\n"))
+	require.ErrorContains(t, err, "line 1")
+}
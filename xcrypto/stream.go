@@ -0,0 +1,282 @@
+package xcrypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xfile"
+)
+
+const (
+	DefaultChunkSize = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+	lastChunk        = 1
+)
+
+// streams are split into chunks that are authenticated one by one,
+// the nonce of a chunk is the header nonce, a counter and a flag marking the last chunk
+// so truncated, reordered and appended chunks are detected
+
+type chunkSealer struct {
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	size    int
+	counter uint32
+}
+
+func (s *chunkSealer) nonce(last bool) ([]byte, error) {
+	if s.counter == ^uint32(0) {
+		return nil, errors.New("xcrypto: stream is too long")
+	}
+	nonce := make([]byte, nonceSize)
+	copy(nonce, s.prefix)
+	binary.BigEndian.PutUint32(nonce[len(s.prefix):], s.counter)
+	if last {
+		nonce[nonceSize-1] = lastChunk
+	}
+	s.counter++
+	return nonce, nil
+}
+
+func (s *chunkSealer) seal(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce, err := s.nonce(last)
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(dst, nonce, chunk, s.header), nil
+}
+
+func (s *chunkSealer) open(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce, err := s.nonce(last)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.aead.Open(dst, nonce, chunk, s.header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newChunkSealer(secret Secret, c Cipher, chunkSize int) (*chunkSealer, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize > maxChunkSize {
+		return nil, errors.New("xcrypto: chunk size is too large")
+	}
+	h, err := newEnvelopeHeader(secret, c, modeStream, uint32(chunkSize))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkSealer{aead: aead, header: h.marshal(), prefix: h.nonce, size: chunkSize}, nil
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	sealer *chunkSealer
+	buf    []byte
+	header bool
+	closed bool
+}
+
+// NewEncryptWriter encrypts everything written to w in chunks of chunkSize, 0 uses DefaultChunkSize.
+// Close must be called to write the last chunk, it does not close w.
+func NewEncryptWriter(w io.Writer, secret Secret, c Cipher, chunkSize int) (io.WriteCloser, error) {
+	sealer, err := newChunkSealer(secret, c, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, sealer: sealer, buf: make([]byte, 0, sealer.size)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("xcrypto: write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		// a full chunk is only flushed once more data follows, the last chunk is written by Close
+		if len(e.buf) == e.sealer.size {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(e.buf[len(e.buf):e.sealer.size], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	if !e.header {
+		if _, err := e.w.Write(e.sealer.header); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	out, err := e.sealer.seal(nil, e.buf, last)
+	if err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+	_, err = e.w.Write(out)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+type encryptReader struct {
+	r      *bufio.Reader
+	sealer *chunkSealer
+	chunk  []byte
+	out    []byte
+	done   bool
+}
+
+// NewEncryptReader returns the encrypted stream of r, e.g. for xfile.CopyToFile
+func NewEncryptReader(r io.Reader, secret Secret, c Cipher, chunkSize int) (io.Reader, error) {
+	sealer, err := newChunkSealer(secret, c, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		r:      bufio.NewReaderSize(r, sealer.size+1),
+		sealer: sealer,
+		chunk:  make([]byte, sealer.size),
+		out:    append([]byte{}, sealer.header...),
+	}, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.r, e.chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			// a full chunk is the last one when nothing follows
+			if _, err := e.r.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		e.out, err = e.sealer.seal(e.out[:0], e.chunk[:n], last)
+		if err != nil {
+			return 0, err
+		}
+		e.done = last
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+type decryptReader struct {
+	r      *bufio.Reader
+	sealer *chunkSealer
+	chunk  []byte
+	out    []byte
+	done   bool
+}
+
+// NewDecryptReader decrypts a stream of NewEncryptWriter or NewEncryptReader.
+// A chunk is only returned after it was authenticated, a truncated stream fails with ErrDecrypt.
+func NewDecryptReader(r io.Reader, secret Secret) (io.Reader, error) {
+	h, header, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.mode != modeStream {
+		return nil, errors.New("xcrypto: envelope is not a stream, use Open")
+	}
+	aead, err := h.aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	size := int(h.chunkSize) + aead.Overhead()
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, size+1),
+		sealer: &chunkSealer{aead: aead, header: header, prefix: h.nonce, size: int(h.chunkSize)},
+		chunk:  make([]byte, size),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.r, d.chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			if _, err := d.r.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		d.out, err = d.sealer.open(d.out[:0], d.chunk[:n], last)
+		if err != nil {
+			return 0, err
+		}
+		d.done = last
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// EncryptFile encrypts src into dst
+func EncryptFile(src, dst string, secret Secret, c Cipher) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := NewEncryptReader(file, secret, c, DefaultChunkSize)
+	if err != nil {
+		return err
+	}
+	return xfile.CopyToFileAtomic(r, dst, true, nil)
+}
+
+// DecryptFile decrypts src into dst, dst is left untouched when the stream fails to authenticate.
+// Unauthenticated plaintext is never visible at dst, it is only renamed into place once complete.
+func DecryptFile(src, dst string, secret Secret) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := NewDecryptReader(file, secret)
+	if err != nil {
+		return err
+	}
+	return xfile.CopyToFileAtomic(r, dst, true, nil)
+}
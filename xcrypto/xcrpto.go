@@ -1,37 +1,26 @@
 package xcrypto
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"math/big"
-	"net"
 	"time"
 )
 
+// CreateX508Cert creates the RSA CA used by the mitm proxy, see CreateCA for more options
 func CreateX508Cert() (*rsa.PrivateKey, *x509.Certificate, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	template := &x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano() / 100000),
+	ca, err := CreateCA(&CAOptions{
+		KeyAlgorithm: RSA,
+		RSABits:      2048,
 		Subject: pkix.Name{
 			CommonName:   "mitmproxy",
 			Organization: []string{"mitmproxy"},
 		},
-		NotBefore:             time.Now().Add(-time.Hour * 48),
-		NotAfter:              time.Now().Add(time.Hour * 24 * 365 * 3),
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		SignatureAlgorithm:    x509.SHA256WithRSA,
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		Validity: time.Hour*24*365*3 + DefaultBackdate,
 		ExtKeyUsage: []x509.ExtKeyUsage{
 			x509.ExtKeyUsageServerAuth,
 			x509.ExtKeyUsageClientAuth,
@@ -42,80 +31,80 @@ func CreateX508Cert() (*rsa.PrivateKey, *x509.Certificate, error) {
 			x509.ExtKeyUsageMicrosoftServerGatedCrypto,
 			x509.ExtKeyUsageNetscapeServerGatedCrypto,
 		},
-	}
-
-	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-	cert, err := x509.ParseCertificate(certBytes)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return key, cert, nil
+	return ca.Key.(*rsa.PrivateKey), ca.Cert, nil
 }
 
+// DummyCert issues a certificate for commonName with a fresh leaf key, see CertIssuer for caching
 func DummyCert(priv *rsa.PrivateKey, cert *x509.Certificate, commonName string) (*tls.Certificate, error) {
-	template := &x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano() / 100000),
-		Subject: pkix.Name{
-			CommonName:   commonName,
-			Organization: []string{commonName},
-		},
-		NotBefore:          time.Now().Add(-time.Hour * 48),
-		NotAfter:           time.Now().Add(time.Hour * 24 * 365),
-		SignatureAlgorithm: x509.SHA256WithRSA,
-		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-	}
-
-	ip := net.ParseIP(commonName)
-	if ip != nil {
-		template.IPAddresses = []net.IP{ip}
-	} else {
-		template.DNSNames = []string{commonName}
-	}
-
-	certBytes, err := x509.CreateCertificate(rand.Reader, template, cert, priv.PublicKey, priv)
+	key, err := GenerateKey(ECDSAP256, 0)
 	if err != nil {
 		return nil, err
 	}
+	return issueLeaf(&CA{Key: priv, Cert: cert}, key, []string{commonName}, DefaultLeafValidity)
+}
 
-	return &tls.Certificate{
-		Certificate: [][]byte{certBytes},
-		PrivateKey:  priv,
+// X509ToTlsCert combines the certificate, its chain and the matching private key.
+// RSA, ECDSA and Ed25519 keys are supported, the key must belong to the certificate.
+func X509ToTlsCert(cert *x509.Certificate, priv crypto.PrivateKey, chain ...*x509.Certificate) (tls.Certificate, error) {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	if err := checkKeyPair(cert, signer); err != nil {
+		return tls.Certificate{}, err
+	}
+	certs := [][]byte{cert.Raw}
+	for _, c := range chain {
+		certs = append(certs, c.Raw)
+	}
+	return tls.Certificate{
+		Certificate: certs,
+		PrivateKey:  signer,
+		Leaf:        cert,
 	}, nil
 }
 
-func X509ToTlsCert(cert *x509.Certificate, priv interface{}) (tls.Certificate, error) {
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
-
-	var keyPEM []byte
-	switch key := priv.(type) {
-	case *rsa.PrivateKey:
-		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-	case *ecdsa.PrivateKey:
-		keyBytes, err := x509.MarshalECPrivateKey(key)
+// TlsCertToX509 returns the private key and the parsed chain, starting with the leaf
+func TlsCertToX509(cert tls.Certificate) (crypto.Signer, []*x509.Certificate, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, nil, errors.New("tls certificate is empty")
+	}
+	certs := make([]*x509.Certificate, 0, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		if i == 0 && cert.Leaf != nil {
+			certs = append(certs, cert.Leaf)
+			continue
+		}
+		c, err := x509.ParseCertificate(der)
 		if err != nil {
-			return tls.Certificate{}, fmt.Errorf("failed to marshal ECDSA private key: %v", err)
+			return nil, nil, fmt.Errorf("failed to parse certificate: %v", err)
 		}
-		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
-	default:
-		return tls.Certificate{}, fmt.Errorf("unsupported private key type")
+		certs = append(certs, c)
+	}
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type %T", cert.PrivateKey)
+	}
+	if err := checkKeyPair(certs[0], signer); err != nil {
+		return nil, nil, err
 	}
-	return tls.X509KeyPair(certPEM, keyPEM)
+	return signer, certs, nil
 }
 
+// X509ToTlsCerts returns the RSA key and leaf of the certificate, see TlsCertToX509 for other keys
 func X509ToTlsCerts(cert tls.Certificate) (*rsa.PrivateKey, *x509.Certificate, error) {
-	certPEM := cert.Certificate[0]
-	block, _ := pem.Decode(certPEM)
-	if block == nil {
-		return nil, nil, fmt.Errorf("failed to decode certificate PEM")
-	}
-	x509Cert, err := x509.ParseCertificate(block.Bytes)
+	key, certs, err := TlsCertToX509(cert)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse certificate: %v", err)
+		return nil, nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("private key is %T, not RSA", key)
 	}
-	keyPEM := cert.PrivateKey.(*rsa.PrivateKey)
-	return keyPEM, x509Cert, nil
+	return rsaKey, certs[0], nil
 }
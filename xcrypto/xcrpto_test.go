@@ -1 +1,98 @@
 package xcrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateX508Cert(t *testing.T) {
+	key, cert, err := CreateX508Cert()
+	require.NoError(t, err)
+	require.Equal(t, 2048, key.N.BitLen())
+	require.Equal(t, "mitmproxy", cert.Subject.CommonName)
+	require.True(t, cert.IsCA)
+	require.Equal(t, x509.SHA256WithRSA, cert.SignatureAlgorithm)
+	require.Len(t, cert.ExtKeyUsage, 8)
+}
+
+func TestCreateCA(t *testing.T) {
+	notBefore := time.Now().Truncate(time.Second).UTC()
+	for _, alg := range []KeyAlgorithm{RSA, ECDSAP256, ECDSAP384, Ed25519} {
+		ca, err := CreateCA(&CAOptions{
+			KeyAlgorithm:        alg,
+			Subject:             pkix.Name{CommonName: "Test CA", Country: []string{"CN"}},
+			NotBefore:           notBefore,
+			Validity:            time.Hour,
+			MaxPathLenZero:      true,
+			PermittedDNSDomains: []string{".example.com"},
+		})
+		require.NoError(t, err, alg)
+		require.NoError(t, ca.Cert.CheckSignatureFrom(ca.Cert))
+		require.Equal(t, "Test CA", ca.Cert.Subject.CommonName)
+		require.Equal(t, []string{"CN"}, ca.Cert.Subject.Country)
+		require.Equal(t, notBefore.Add(time.Hour), ca.Cert.NotAfter)
+		require.Equal(t, 0, ca.Cert.MaxPathLen)
+		require.True(t, ca.Cert.MaxPathLenZero)
+		require.Equal(t, []string{".example.com"}, ca.Cert.PermittedDNSDomains)
+		require.Greater(t, ca.Cert.SerialNumber.BitLen(), 64)
+		switch alg {
+		case RSA:
+			require.IsType(t, &rsa.PrivateKey{}, ca.Key)
+		case ECDSAP256, ECDSAP384:
+			require.IsType(t, &ecdsa.PrivateKey{}, ca.Key)
+		case Ed25519:
+			require.IsType(t, ed25519.PrivateKey{}, ca.Key)
+		}
+	}
+
+	ca, err := CreateCA(nil)
+	require.NoError(t, err)
+	require.Equal(t, DefaultCAName, ca.Cert.Subject.CommonName)
+	require.Equal(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign|x509.KeyUsageDigitalSignature, ca.Cert.KeyUsage)
+}
+
+func TestTlsCertConversion(t *testing.T) {
+	for _, alg := range []KeyAlgorithm{RSA, ECDSAP256, Ed25519} {
+		ca, err := CreateCA(&CAOptions{KeyAlgorithm: alg})
+		require.NoError(t, err)
+		issuer, err := NewCertIssuer(ca, &IssuerOptions{KeyAlgorithm: alg})
+		require.NoError(t, err)
+		issued, err := issuer.Issue("example.com")
+		require.NoError(t, err)
+
+		cert, err := X509ToTlsCert(issued.Leaf, issued.PrivateKey, ca.Cert)
+		require.NoError(t, err)
+		require.Same(t, issued.Leaf, cert.Leaf)
+		require.Equal(t, issued.Certificate, cert.Certificate)
+
+		cert.Leaf = nil
+		key, chain, err := TlsCertToX509(cert)
+		require.NoError(t, err)
+		require.Equal(t, issued.PrivateKey, key)
+		require.Len(t, chain, 2)
+		require.True(t, chain[0].Equal(issued.Leaf))
+		require.True(t, chain[1].Equal(ca.Cert))
+
+		rsaKey, leaf, err := X509ToTlsCerts(cert)
+		if alg == RSA {
+			require.NoError(t, err)
+			require.Equal(t, issued.PrivateKey, rsaKey)
+			require.True(t, leaf.Equal(issued.Leaf))
+		} else {
+			require.Error(t, err)
+		}
+
+		_, err = X509ToTlsCert(issued.Leaf, ca.Key)
+		require.Error(t, err)
+		cert.PrivateKey = ca.Key
+		_, _, err = TlsCertToX509(cert)
+		require.Error(t, err)
+	}
+}
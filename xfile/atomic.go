@@ -0,0 +1,174 @@
+package xfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultFilePerm is the mode of new files written without a mode, before the umask
+const DefaultFilePerm os.FileMode = 0644
+
+// maxSymlinks bounds the symlinks followed to the destination file
+const maxSymlinks = 40
+
+type AtomicOptions struct {
+	// Perm is set exactly, without the umask. 0 keeps the mode of an existing file,
+	// new files get DefaultFilePerm or the source mode when copying, minus the umask.
+	Perm os.FileMode
+	// Chown sets UID and GID, otherwise the owner of an existing file is kept when permitted
+	Chown bool
+	UID   int
+	GID   int
+}
+
+// WriteFileAtomic replaces path with data, readers see either the old or the new content.
+// The data is written to a temp file in the same directory, synced and renamed over path.
+// When path is a symlink the file it points to is replaced and the link is kept.
+func WriteFileAtomic(path string, data []byte, opts *AtomicOptions) error {
+	return writeAtomic(path, bytes.NewReader(data), true, opts, DefaultFilePerm)
+}
+
+// CopyFileAtomic copies srcFile over dstFile like WriteFileAtomic, new files get the mode of srcFile
+func CopyFileAtomic(srcFile, dstFile string, opts *AtomicOptions) error {
+	if IsDirectory(srcFile) {
+		return fmt.Errorf("source path %s is a directory", srcFile)
+	}
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return fmt.Errorf("failed to open source file %s: %w", srcFile, err)
+	}
+	defer src.Close()
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	return writeAtomic(dstFile, src, true, opts, srcInfo.Mode().Perm())
+}
+
+// CopyToFileAtomic is the atomic mode of CopyToFile, dstFile is left untouched when srcFile fails
+func CopyToFileAtomic(srcFile io.Reader, dstFile string, overwrite bool, opts *AtomicOptions) error {
+	return writeAtomic(dstFile, srcFile, overwrite, opts, DefaultFilePerm)
+}
+
+// writeAtomic replaces path with the content of r, newPerm is the mode of a new file before the umask
+func writeAtomic(path string, r io.Reader, overwrite bool, opts *AtomicOptions, newPerm os.FileMode) (err error) {
+	if opts == nil {
+		opts = &AtomicOptions{}
+	}
+	if path, err = resolveSymlinks(path); err != nil {
+		return err
+	}
+	perm, uid, gid := opts.Perm, -1, -1
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("destination path %s is a directory", path)
+		}
+		if !overwrite {
+			return fmt.Errorf("dest file is already exists: %s", path)
+		}
+		if perm == 0 {
+			perm = info.Mode().Perm()
+		}
+		uid, gid = fileOwner(info)
+	}
+	if opts.Chown {
+		uid, gid = opts.UID, opts.GID
+	}
+
+	dir := filepath.Dir(path)
+	// a new file is created with newPerm so that the kernel applies the umask
+	createPerm := newPerm
+	if perm != 0 {
+		createPerm = 0600
+	}
+	tmp, err := createTemp(dir, filepath.Base(path), createPerm)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = io.Copy(tmp, r); err != nil {
+		return fmt.Errorf("failed to copy to file %s: %w", path, err)
+	}
+	if perm != 0 {
+		if err = tmp.Chmod(perm); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %w", path, err)
+		}
+	}
+	if uid >= 0 || gid >= 0 {
+		// only an explicit owner fails when the process is not permitted to set it
+		if err = tmp.Chown(uid, gid); err != nil && (opts.Chown || !os.IsPermission(err)) {
+			return fmt.Errorf("failed to set owner of %s: %w", path, err)
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if overwrite {
+		err = os.Rename(tmp.Name(), path)
+	} else {
+		err = renameNoReplace(tmp.Name(), path)
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// renameNoReplace links the temp file to path, which fails if path was created meanwhile
+func renameNoReplace(tmp, path string) error {
+	err := os.Link(tmp, path)
+	if err == nil {
+		return os.Remove(tmp)
+	}
+	if os.IsExist(err) {
+		return fmt.Errorf("dest file is already exists: %s", path)
+	}
+	// file systems without hard links
+	if IsExist(path) {
+		return fmt.Errorf("dest file is already exists: %s", path)
+	}
+	return os.Rename(tmp, path)
+}
+
+// createTemp creates a hidden temp file next to name with mode perm, minus the umask
+func createTemp(dir, name string, perm os.FileMode) (*os.File, error) {
+	for try := 0; ; try++ {
+		f, err := os.OpenFile(filepath.Join(dir, "."+name+".tmp-"+strconv.FormatUint(rand.Uint64(), 36)), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// resolveSymlinks follows symlinks at path to the file they point to, which may not exist yet
+func resolveSymlinks(path string) (string, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return "", fmt.Errorf("too many symlinks at %s", path)
+}
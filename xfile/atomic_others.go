@@ -0,0 +1,14 @@
+//go:build !unix
+
+package xfile
+
+import "os"
+
+func fileOwner(info os.FileInfo) (int, int) {
+	return -1, -1
+}
+
+// syncDir is a no-op, directories can not be synced on these systems
+func syncDir(dir string) error {
+	return nil
+}
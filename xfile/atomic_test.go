@@ -0,0 +1,137 @@
+package xfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("connection reset")
+	}
+	r.n--
+	return copy(p, "partial "), nil
+}
+
+func requireNoTempFiles(t *testing.T, dir string) {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), ".tmp-")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, WriteFileAtomic(path, []byte("v1"), nil))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		require.Equal(t, DefaultFilePerm, info.Mode().Perm())
+
+		// the mode of an existing file is kept unless set
+		require.NoError(t, os.Chmod(path, 0640))
+		require.NoError(t, WriteFileAtomic(path, []byte("v2"), nil))
+		info, err = os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		require.NoError(t, WriteFileAtomic(path, []byte("v3"), &AtomicOptions{Perm: 0600}))
+		info, err = os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		// setting the own owner is always permitted
+		require.NoError(t, WriteFileAtomic(path, []byte("v4"), &AtomicOptions{Chown: true, UID: os.Getuid(), GID: os.Getgid()}))
+		info, err = os.Stat(path)
+		require.NoError(t, err)
+		uid, gid := fileOwner(info)
+		require.Equal(t, os.Getuid(), uid)
+		require.Equal(t, os.Getgid(), gid)
+	}
+
+	// a failing write leaves the previous content
+	require.Error(t, CopyToFileAtomic(&failingReader{n: 3}, path, true, nil))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "partial")
+	requireNoTempFiles(t, dir)
+
+	require.Error(t, WriteFileAtomic(dir, []byte("v5"), nil))
+	require.Error(t, WriteFileAtomic(filepath.Join(dir, "missing", "file"), []byte("v5"), nil))
+}
+
+func TestCopyFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "run.sh"), filepath.Join(dir, "bin", "run.sh")
+	require.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.Chmod(src, 0755))
+	require.NoError(t, MkdirParent(dst))
+	require.NoError(t, CopyFileAtomic(src, dst, nil))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\n", string(data))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(dst)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+	require.Error(t, CopyFileAtomic(dir, dst, nil))
+	require.Error(t, CopyFileAtomic(filepath.Join(dir, "missing"), dst, nil))
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, CopyDir(src, dst, false))
+	require.Error(t, CopyDir(src, dst, false))
+	require.NoError(t, CopyDir(src, dst, true))
+	data, err := os.ReadFile(filepath.Join(dst, "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\n", string(data))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dst, "run.sh"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+
+	// CopyToFile keeps the previous content when the reader fails
+	require.Error(t, CopyToFile(&failingReader{n: 2}, filepath.Join(dst, "run.sh"), true))
+	data, err = os.ReadFile(filepath.Join(dst, "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\n", string(data))
+	requireNoTempFiles(t, dst)
+}
+
+func TestCopyToFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "download")
+	require.NoError(t, CopyToFileAtomic(strings.NewReader("first"), path, false, nil))
+	err := CopyToFileAtomic(strings.NewReader("second"), path, false, nil)
+	require.ErrorContains(t, err, "already exists")
+	require.NoError(t, CopyToFileAtomic(io.MultiReader(strings.NewReader("sec"), strings.NewReader("ond")), path, true, nil))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+	requireNoTempFiles(t, dir)
+
+	// a failing download never creates the file
+	fresh := filepath.Join(dir, "fresh")
+	require.Error(t, CopyToFileAtomic(&failingReader{n: 1}, fresh, false, nil))
+	require.NoFileExists(t, fresh)
+	requireNoTempFiles(t, dir)
+}
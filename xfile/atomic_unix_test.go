@@ -0,0 +1,74 @@
+//go:build unix
+
+package xfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicUmask(t *testing.T) {
+	defer syscall.Umask(syscall.Umask(027))
+	dir := t.TempDir()
+	requirePerm := func(path string, perm os.FileMode) {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, perm, info.Mode().Perm())
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, WriteFileAtomic(path, []byte("v1"), nil))
+	requirePerm(path, 0640)
+	src := filepath.Join(dir, "run.sh")
+	require.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.Chmod(src, 0755))
+	require.NoError(t, CopyFileAtomic(src, filepath.Join(dir, "copy.sh"), nil))
+	requirePerm(filepath.Join(dir, "copy.sh"), 0750)
+
+	// an explicit mode ignores the umask
+	explicit := filepath.Join(dir, "explicit")
+	require.NoError(t, WriteFileAtomic(explicit, []byte("v1"), &AtomicOptions{Perm: 0666}))
+	requirePerm(explicit, 0666)
+}
+
+func TestAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data", "config.yaml")
+	require.NoError(t, MkdirParent(target))
+	require.NoError(t, os.WriteFile(target, []byte("v1"), 0600))
+	link := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.Symlink(filepath.Join("data", "config.yaml"), link))
+	chain := filepath.Join(dir, "current")
+	require.NoError(t, os.Symlink(link, chain))
+
+	// the link is kept and the file it points to is replaced with its mode
+	require.NoError(t, WriteFileAtomic(chain, []byte("v2"), nil))
+	info, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeSymlink)
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(data))
+	info, err = os.Stat(target)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	requireNoTempFiles(t, dir)
+
+	// a dangling link creates its target
+	dangling := filepath.Join(dir, "dangling")
+	require.NoError(t, os.Symlink("created", dangling))
+	require.NoError(t, CopyToFileAtomic(strings.NewReader("new"), dangling, false, nil))
+	data, err = os.ReadFile(filepath.Join(dir, "created"))
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+	require.ErrorContains(t, CopyToFileAtomic(strings.NewReader("again"), dangling, false, nil), "already exists")
+
+	loop := filepath.Join(dir, "loop")
+	require.NoError(t, os.Symlink("loop", loop))
+	require.Error(t, WriteFileAtomic(loop, []byte("v1"), nil))
+}
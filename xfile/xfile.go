@@ -3,8 +3,10 @@ package xfile
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 func GetTempPath(path ...string) string {
@@ -176,6 +178,30 @@ func RemoveFile(path ...string) error {
 	return nil
 }
 
+// ListFiles returns the regular files below dir as sorted slash separated relative paths, symlinks are skipped
+func ListFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s: %w", dir, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
 // CopyDir recursively copies a directory from srcDir to dstDir
 func CopyDir(srcDir, dstDir string, overwrite bool) error {
 	srcInfo, err := os.Stat(srcDir)
@@ -227,38 +253,14 @@ func CopyFile(srcFile, dstFile string, overwrite bool) error {
 		return fmt.Errorf("failed to open source file %s: %v", srcFile, err)
 	}
 	defer src.Close()
-	err = CopyToFile(src, dstFile, overwrite)
+	srcInfo, err := src.Stat()
 	if err != nil {
 		return err
 	}
-	srcInfo, err := os.Stat(srcFile)
-	if err != nil {
-		return err
-	}
-	return os.Chmod(dstFile, srcInfo.Mode())
+	return writeAtomic(dstFile, src, overwrite, nil, srcInfo.Mode().Perm())
 }
 
+// CopyToFile replaces dstFile atomically, see CopyToFileAtomic
 func CopyToFile(srcFile io.Reader, dstFile string, overwrite bool) error {
-	if IsExist(dstFile) {
-		if overwrite {
-			err := RemoveFile(dstFile)
-			if err != nil {
-				return fmt.Errorf("failed to remove destination file %s: %v", dstFile, err)
-			}
-		} else {
-			return fmt.Errorf("dest file is already exists: %s", dstFile)
-		}
-	}
-
-	dst, err := os.Create(dstFile)
-	if err != nil {
-		return fmt.Errorf("failed to create destination file %s: %v", dstFile, err)
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, srcFile)
-	if err != nil {
-		return fmt.Errorf("failed to copy file from %s to %s: %v", srcFile, dstFile, err)
-	}
-	return nil
+	return CopyToFileAtomic(srcFile, dstFile, overwrite, nil)
 }
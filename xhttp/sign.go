@@ -0,0 +1,399 @@
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Requests are signed like AWS signature v4: a canonical request of method, path, sorted query,
+// signed headers and body hash is hashed into a string to sign, which is signed with HMAC-SHA256.
+//
+//	Authorization: HMAC-SHA256 Credential=<key id>, SignedHeaders=host;x-content-sha256;x-date;x-nonce, Signature=<hex>
+const (
+	SignatureAlgorithm  = "HMAC-SHA256"
+	DateHeader          = "X-Date"
+	NonceHeader         = "X-Nonce"
+	ContentSHA256Header = "X-Content-Sha256"
+
+	// DateFormat is the ISO 8601 basic format of DateHeader
+	DateFormat = "20060102T150405Z"
+
+	DefaultMaxSkew     = 5 * time.Minute
+	DefaultMaxBodySize = 10 << 20
+)
+
+var (
+	ErrSignatureMissing = errors.New("xhttp: request is not signed")
+	ErrSignatureInvalid = errors.New("xhttp: invalid request signature")
+	ErrSignatureExpired = errors.New("xhttp: request signature is expired")
+	ErrNonceReused      = errors.New("xhttp: request nonce was already used")
+	ErrUnknownKeyID     = errors.New("xhttp: unknown signing key")
+	ErrBodyTooLarge     = errors.New("xhttp: request body is too large")
+
+	// mandatoryHeaders are signed by every request
+	mandatoryHeaders = []string{"host", strings.ToLower(ContentSHA256Header), strings.ToLower(DateHeader), strings.ToLower(NonceHeader)}
+)
+
+type RequestSigner struct {
+	KeyID         string
+	Secret        []byte
+	SignedHeaders []string
+	Now           func() time.Time
+}
+
+func NewRequestSigner(keyID string, secret []byte) *RequestSigner {
+	return &RequestSigner{KeyID: keyID, Secret: secret, Now: time.Now}
+}
+
+// SetSignedHeaders adds headers to the mandatory host, date, nonce and body hash headers
+func (s *RequestSigner) SetSignedHeaders(headers ...string) *RequestSigner {
+	s.SignedHeaders = headers
+	return s
+}
+
+func (s *RequestSigner) SetNow(now func() time.Time) *RequestSigner {
+	s.Now = now
+	return s
+}
+
+// Sign sets the date, nonce, body hash and authorization headers, the body is buffered and restored
+func (s *RequestSigner) Sign(r *http.Request) error {
+	body, err := readBody(r, -1)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	bodyHash := sha256.Sum256(body)
+	r.Header.Set(DateHeader, s.Now().UTC().Format(DateFormat))
+	r.Header.Set(NonceHeader, hex.EncodeToString(nonce))
+	r.Header.Set(ContentSHA256Header, hex.EncodeToString(bodyHash[:]))
+
+	signed := signedHeaderNames(append(append([]string{}, mandatoryHeaders...), s.SignedHeaders...))
+	signature := sign(s.Secret, s.KeyID, r, signed, hex.EncodeToString(bodyHash[:]))
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		SignatureAlgorithm, s.KeyID, strings.Join(signed, ";"), signature))
+	return nil
+}
+
+// RoundTripper signs a clone of every request before passing it to next, http.DefaultTransport for nil
+func (s *RequestSigner) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		clone := r.Clone(r.Context())
+		if r.Body != nil && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body.Close()
+			clone.Body = body
+		}
+		if err := s.Sign(clone); err != nil {
+			if clone.Body != nil {
+				clone.Body.Close()
+			}
+			return nil, err
+		}
+		return next.RoundTrip(clone)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// NonceStore remembers nonces for ttl, Use reports false for a nonce that is already known
+type NonceStore interface {
+	Use(nonce string, ttl time.Duration) bool
+}
+
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	purged time.Time
+}
+
+// NewMemoryNonceStore keeps nonces of a single process, use a shared store for several instances
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+func (m *memoryNonceStore) Use(nonce string, ttl time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.purged) > time.Minute {
+		for n, e := range m.nonces {
+			if now.After(e) {
+				delete(m.nonces, n)
+			}
+		}
+		m.purged = now
+	}
+	if e, ok := m.nonces[nonce]; ok && !now.After(e) {
+		return false
+	}
+	m.nonces[nonce] = now.Add(ttl)
+	return true
+}
+
+type RequestVerifier struct {
+	Secrets         map[string][]byte
+	RequiredHeaders []string
+	MaxSkew         time.Duration
+	MaxBodySize     int64
+	Nonces          NonceStore
+	Now             func() time.Time
+}
+
+func NewRequestVerifier() *RequestVerifier {
+	return &RequestVerifier{
+		Secrets:     map[string][]byte{},
+		MaxSkew:     DefaultMaxSkew,
+		MaxBodySize: DefaultMaxBodySize,
+		Nonces:      NewMemoryNonceStore(),
+		Now:         time.Now,
+	}
+}
+
+func (v *RequestVerifier) AddSecret(keyID string, secret []byte) *RequestVerifier {
+	v.Secrets[keyID] = secret
+	return v
+}
+
+// SetRequiredHeaders rejects signatures that do not cover these headers
+func (v *RequestVerifier) SetRequiredHeaders(headers ...string) *RequestVerifier {
+	v.RequiredHeaders = headers
+	return v
+}
+
+func (v *RequestVerifier) SetMaxSkew(skew time.Duration) *RequestVerifier {
+	v.MaxSkew = skew
+	return v
+}
+
+func (v *RequestVerifier) SetMaxBodySize(size int64) *RequestVerifier {
+	v.MaxBodySize = size
+	return v
+}
+
+func (v *RequestVerifier) SetNonceStore(store NonceStore) *RequestVerifier {
+	v.Nonces = store
+	return v
+}
+
+func (v *RequestVerifier) SetNow(now func() time.Time) *RequestVerifier {
+	v.Now = now
+	return v
+}
+
+// Verify checks the signature, the date and the nonce and returns the key id, the body is restored
+func (v *RequestVerifier) Verify(r *http.Request) (string, error) {
+	scheme, params, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != SignatureAlgorithm {
+		return "", ErrSignatureMissing
+	}
+	fields := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		fields[name] = value
+	}
+	keyID, signature := fields["Credential"], fields["Signature"]
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if keyID == "" || signature == "" {
+		return "", fmt.Errorf("%w: malformed authorization header", ErrSignatureInvalid)
+	}
+	if !sort.StringsAreSorted(signed) {
+		return "", fmt.Errorf("%w: signed headers are not sorted", ErrSignatureInvalid)
+	}
+	for _, required := range append(append([]string{}, mandatoryHeaders...), v.RequiredHeaders...) {
+		if i := sort.SearchStrings(signed, strings.ToLower(required)); i == len(signed) || signed[i] != strings.ToLower(required) {
+			return "", fmt.Errorf("%w: header %s is not signed", ErrSignatureInvalid, required)
+		}
+	}
+	secret, ok := v.Secrets[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKeyID, keyID)
+	}
+
+	date, err := time.Parse(DateFormat, r.Header.Get(DateHeader))
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid %s header", ErrSignatureInvalid, DateHeader)
+	}
+	if skew := v.Now().Sub(date); skew > v.MaxSkew || skew < -v.MaxSkew {
+		return "", fmt.Errorf("%w: signed at %s", ErrSignatureExpired, date.Format(time.RFC3339))
+	}
+
+	body, err := readBody(r, v.MaxBodySize)
+	if err != nil {
+		return "", err
+	}
+	bodyHash := sha256.Sum256(body)
+	expected := sign(secret, keyID, r, signed, hex.EncodeToString(bodyHash[:]))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return "", ErrSignatureInvalid
+	}
+
+	// nonces are only recorded for valid signatures, so nobody can use them up
+	nonce := r.Header.Get(NonceHeader)
+	if nonce == "" {
+		return "", fmt.Errorf("%w: missing %s header", ErrSignatureInvalid, NonceHeader)
+	}
+	// the nonce has to be remembered until the date leaves the allowed skew
+	if v.Nonces != nil && !v.Nonces.Use(keyID+"/"+nonce, date.Add(v.MaxSkew).Sub(v.Now())) {
+		return "", ErrNonceReused
+	}
+	return keyID, nil
+}
+
+type signedKeyIDKey struct{}
+
+// Middleware answers 401 to requests without a valid signature, see SignedKeyID
+func (v *RequestVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := v.Verify(r)
+		if errors.Is(err, ErrBodyTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", SignatureAlgorithm)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), signedKeyIDKey{}, keyID)))
+	})
+}
+
+// SignedKeyID returns the key id of a request that passed the Middleware
+func SignedKeyID(ctx context.Context) string {
+	keyID, _ := ctx.Value(signedKeyIDKey{}).(string)
+	return keyID
+}
+
+// CanonicalRequest is the signature v4 canonical request, signedHeaders must be sorted lower case names
+func CanonicalRequest(r *http.Request, signedHeaders []string, bodyHash string) string {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	query := []string{}
+	for key, values := range r.URL.Query() {
+		for _, value := range values {
+			query = append(query, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(query)
+	headers := strings.Builder{}
+	for _, name := range signedHeaders {
+		var values []string
+		if name == "host" {
+			values = []string{r.Host}
+			if r.Host == "" {
+				values = []string{r.URL.Host}
+			}
+		} else {
+			values = append([]string{}, r.Header.Values(name)...)
+		}
+		for i, value := range values {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(path, false),
+		strings.Join(query, "&"),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		bodyHash,
+	}, "\n")
+}
+
+func sign(secret []byte, keyID string, r *http.Request, signedHeaders []string, bodyHash string) string {
+	canonical := sha256.Sum256([]byte(CanonicalRequest(r, signedHeaders, bodyHash)))
+	stringToSign := strings.Join([]string{
+		SignatureAlgorithm,
+		r.Header.Get(DateHeader),
+		keyID,
+		hex.EncodeToString(canonical[:]),
+	}, "\n")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func signedHeaderNames(headers []string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, header := range headers {
+		name := strings.ToLower(strings.TrimSpace(header))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// uriEncode escapes everything but the RFC 3986 unreserved characters, slashes are kept in paths
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0f])
+	}
+	return b.String()
+}
+
+// readBody reads and restores the body, limit < 0 reads everything
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	defer r.Body.Close()
+	reader := io.Reader(r.Body)
+	if limit >= 0 {
+		reader = io.LimitReader(r.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, limit)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
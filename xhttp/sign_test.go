@@ -0,0 +1,150 @@
+package xhttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// AWS signature v4 example of the IAM ListUsers request
+func TestCanonicalRequestAWSVector(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	r.Header.Set("X-Amz-Date", "20150830T123600Z")
+	canonical := CanonicalRequest(r, []string{"content-type", "host", "x-amz-date"}, emptySHA256)
+	require.Equal(t, "GET\n/\nAction=ListUsers&Version=2010-05-08\n"+
+		"content-type:application/x-www-form-urlencoded; charset=utf-8\nhost:iam.amazonaws.com\nx-amz-date:20150830T123600Z\n\n"+
+		"content-type;host;x-amz-date\n"+emptySHA256, canonical)
+	hash := sha256.Sum256([]byte(canonical))
+	require.Equal(t, "f536975d06c0309214f805bb90ccff089219ecd68b2577efef23edd43b7e1a59", hex.EncodeToString(hash[:]))
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	key := hmacSHA256([]byte("AWS4wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"), "20150830")
+	for _, scope := range []string{"us-east-1", "iam", "aws4_request"} {
+		key = hmacSHA256(key, scope)
+	}
+	signature := hmacSHA256(key, "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/iam/aws4_request\n"+hex.EncodeToString(hash[:]))
+	require.Equal(t, "5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", hex.EncodeToString(signature))
+}
+
+// vectorRequest is signed with key id client-1 and secret "secret", for implementations in other languages
+func vectorRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "http://api.example.com/v1/orders/a%20b?tag=y%2Bz&page=2&flag&tag=x", strings.NewReader(`{"amount":42}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(DateHeader, "20240102T030405Z")
+	r.Header.Set(NonceHeader, "6e6f6e6365")
+	r.Header.Set(ContentSHA256Header, "f26e267ee03331ff5ce10b687a1ba1a9b49012ffb27694c922e17411b4b86e6c")
+	r.Header.Set("Authorization", "HMAC-SHA256 Credential=client-1, SignedHeaders=content-type;host;x-content-sha256;x-date;x-nonce, "+
+		"Signature=aca954fe03954be5a3737feaebfa4db68b913175997d40e4b43175928b51c603")
+	return r
+}
+
+func TestVerifyVector(t *testing.T) {
+	signedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	verifier := NewRequestVerifier().AddSecret("client-1", []byte("secret")).SetRequiredHeaders("Content-Type").
+		SetNow(func() time.Time { return signedAt.Add(time.Minute) })
+
+	r := vectorRequest()
+	keyID, err := verifier.Verify(r)
+	require.NoError(t, err)
+	require.Equal(t, "client-1", keyID)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"amount":42}`, string(body))
+
+	// replay
+	_, err = verifier.Verify(vectorRequest())
+	require.ErrorIs(t, err, ErrNonceReused)
+
+	verifier.SetNonceStore(NewMemoryNonceStore())
+	tampered := []func(r *http.Request){
+		func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"amount":43}`)) },
+		func(r *http.Request) { r.URL.RawQuery += "&extra=1" },
+		func(r *http.Request) { r.Method = http.MethodPut },
+		func(r *http.Request) { r.URL.Path = "/v1/orders/a" },
+		func(r *http.Request) { r.Host = "evil.example.com" },
+		func(r *http.Request) { r.Header.Set("Content-Type", "text/plain") },
+		func(r *http.Request) { r.Header.Set(NonceHeader, "other") },
+	}
+	for i, tamper := range tampered {
+		r := vectorRequest()
+		tamper(r)
+		_, err := verifier.Verify(r)
+		require.ErrorIs(t, err, ErrSignatureInvalid, i)
+	}
+
+	// the signature is still valid, but not for the verifier
+	for _, check := range []struct {
+		verifier *RequestVerifier
+		err      error
+	}{
+		{NewRequestVerifier().AddSecret("client-1", []byte("secret")).SetNow(func() time.Time { return signedAt.Add(time.Hour) }), ErrSignatureExpired},
+		{NewRequestVerifier().AddSecret("client-1", []byte("secret")).SetNow(func() time.Time { return signedAt.Add(-time.Hour) }), ErrSignatureExpired},
+		{NewRequestVerifier().AddSecret("client-2", []byte("secret")), ErrUnknownKeyID},
+		{NewRequestVerifier().AddSecret("client-1", []byte("secret")).SetRequiredHeaders("X-Tenant-Id"), ErrSignatureInvalid},
+		{NewRequestVerifier().AddSecret("client-1", []byte("secret")).SetMaxBodySize(4).SetNow(func() time.Time { return signedAt }), ErrBodyTooLarge},
+	} {
+		_, err := check.verifier.Verify(vectorRequest())
+		require.ErrorIs(t, err, check.err)
+	}
+
+	r = vectorRequest()
+	r.Header.Del("Authorization")
+	_, err = verifier.Verify(r)
+	require.ErrorIs(t, err, ErrSignatureMissing)
+	r = vectorRequest()
+	r.Header.Set("Authorization", "HMAC-SHA256 Credential=client-1, SignedHeaders=host;x-date, Signature=00")
+	_, err = verifier.Verify(r)
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+}
+
+func TestSigningRoundTrip(t *testing.T) {
+	verifier := NewRequestVerifier().AddSecret("client-1", []byte("secret")).SetRequiredHeaders("Content-Type")
+	server := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(SignedKeyID(r.Context()) + ":" + string(body)))
+	})))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRequestSigner("client-1", []byte("secret")).SetSignedHeaders("Content-Type").RoundTripper(nil)}
+	for _, body := range []string{"", "hello", strings.Repeat("x", 100000)} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/path with space/?q=a+b&q=%2F&empty=", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(got))
+		require.Equal(t, "client-1:"+body, string(got))
+		// the caller's request is left untouched
+		require.Empty(t, req.Header.Get("Authorization"))
+	}
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, SignatureAlgorithm, resp.Header.Get("WWW-Authenticate"))
+
+	wrong := &http.Client{Transport: NewRequestSigner("client-1", []byte("wrong")).RoundTripper(nil)}
+	resp, err = wrong.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
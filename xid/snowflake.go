@@ -0,0 +1,131 @@
+package xid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xnet"
+)
+
+// DefaultSnowflakeEpoch is the twitter epoch 2010-11-04T01:42:54.657Z
+var DefaultSnowflakeEpoch = time.UnixMilli(1288834974657)
+
+const (
+	DefaultNodeBits     = 10
+	DefaultSequenceBits = 12
+)
+
+type SnowflakeOptions struct {
+	Epoch        time.Time
+	NodeBits     uint8
+	SequenceBits uint8
+	// Node < 0 derives the node from the first LAN mac address, see DefaultNode
+	Node int64
+}
+
+// Snowflake creates 63 bit IDs of a millisecond time, a node and a sequence.
+// More than 2^SequenceBits IDs in a millisecond borrow time from the next millisecond.
+type Snowflake struct {
+	epoch    int64
+	nodeBits uint8
+	seqBits  uint8
+	node     int64
+
+	mu  sync.Mutex
+	ms  int64
+	seq int64
+}
+
+// SnowflakeID is a decomposed snowflake ID
+type SnowflakeID struct {
+	Time     time.Time
+	Node     int64
+	Sequence int64
+}
+
+// NewSnowflake uses the defaults for nil options and zero fields, except the node
+func NewSnowflake(opts *SnowflakeOptions) (*Snowflake, error) {
+	if opts == nil {
+		opts = &SnowflakeOptions{Node: -1}
+	}
+	s := &Snowflake{
+		epoch:    opts.Epoch.UnixMilli(),
+		nodeBits: opts.NodeBits,
+		seqBits:  opts.SequenceBits,
+		node:     opts.Node,
+	}
+	if opts.Epoch.IsZero() {
+		s.epoch = DefaultSnowflakeEpoch.UnixMilli()
+	}
+	if s.nodeBits == 0 {
+		s.nodeBits = DefaultNodeBits
+	}
+	if s.seqBits == 0 {
+		s.seqBits = DefaultSequenceBits
+	}
+	if int(s.nodeBits)+int(s.seqBits) > 22 {
+		return nil, fmt.Errorf("xid: node and sequence bits leave less than 41 bits of time")
+	}
+	if s.epoch > time.Now().UnixMilli() {
+		return nil, fmt.Errorf("xid: snowflake epoch is in the future")
+	}
+	if s.node < 0 {
+		s.node = DefaultNode(s.nodeBits)
+	}
+	if s.node >= 1<<s.nodeBits {
+		return nil, fmt.Errorf("xid: node %d does not fit into %d bits", s.node, s.nodeBits)
+	}
+	return s, nil
+}
+
+// DefaultNode hashes the first LAN mac address, the host name or random bytes into bits
+func DefaultNode(bits uint8) int64 {
+	h := fnv.New64a()
+	if mac := xnet.GetLanMacFirst(); mac != "" {
+		h.Write([]byte(mac))
+	} else if host, err := os.Hostname(); err == nil && host != "" {
+		h.Write([]byte(host))
+	} else {
+		var buf [8]byte
+		rand.Read(buf[:])
+		h.Write(buf[:])
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(os.Getpid())))
+	return int64(h.Sum64() & (1<<bits - 1))
+}
+
+func (s *Snowflake) Node() int64 {
+	return s.node
+}
+
+// Next returns the next ID, IDs of a generator are strictly increasing
+func (s *Snowflake) Next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms := time.Now().UnixMilli() - s.epoch
+	if ms > s.ms {
+		s.ms, s.seq = ms, 0
+	} else {
+		// the same millisecond or a clock that went backwards continues the sequence
+		s.seq++
+		if s.seq >= 1<<s.seqBits {
+			s.ms++
+			s.seq = 0
+		}
+	}
+	return s.ms<<(s.nodeBits+s.seqBits) | s.node<<s.seqBits | s.seq
+}
+
+// Parse decomposes an ID of a generator with the same options
+func (s *Snowflake) Parse(id int64) SnowflakeID {
+	return SnowflakeID{
+		Time:     time.UnixMilli(id>>(s.nodeBits+s.seqBits) + s.epoch),
+		Node:     id >> s.seqBits & (1<<s.nodeBits - 1),
+		Sequence: id & (1<<s.seqBits - 1),
+	}
+}
@@ -0,0 +1,160 @@
+package xid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ULID is a lexicographically sortable identifier of a 48 bit millisecond time and 80 random bits
+type ULID [16]byte
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ErrInvalidULID = errors.New("xid: invalid ULID")
+	// ErrULIDOverflow is returned when a monotonic generator ran out of ULIDs for a millisecond
+	ErrULIDOverflow = errors.New("xid: monotonic ULID overflow")
+
+	crockfordDecode [256]byte
+
+	defaultULID = NewULIDGenerator(true)
+)
+
+func init() {
+	for i := range crockfordDecode {
+		crockfordDecode[i] = 0xff
+	}
+	for i := 0; i < len(crockford); i++ {
+		crockfordDecode[crockford[i]] = byte(i)
+		crockfordDecode[crockford[i]|0x20] = byte(i)
+	}
+	// Crockford aliases
+	for alias, value := range map[byte]byte{'O': 0, 'I': 1, 'L': 1} {
+		crockfordDecode[alias] = value
+		crockfordDecode[alias|0x20] = value
+	}
+}
+
+// ULIDGenerator creates ULIDs, a monotonic generator increments the random part within a millisecond
+type ULIDGenerator struct {
+	mu        sync.Mutex
+	monotonic bool
+	ms        uint64
+	last      ULID
+}
+
+func NewULIDGenerator(monotonic bool) *ULIDGenerator {
+	return &ULIDGenerator{monotonic: monotonic}
+}
+
+func (g *ULIDGenerator) New() (ULID, error) {
+	return g.NewAt(time.Now())
+}
+
+func (g *ULIDGenerator) NewAt(t time.Time) (ULID, error) {
+	ms := uint64(t.UnixMilli())
+	if ms >= 1<<48 {
+		return ULID{}, fmt.Errorf("%w: time %s is out of range", ErrInvalidULID, t)
+	}
+	var u ULID
+	if g.monotonic {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if ms <= g.ms {
+			// same or earlier millisecond, continue after the last ULID
+			u = g.last
+			for i := len(u) - 1; i >= 6; i-- {
+				u[i]++
+				if u[i] != 0 {
+					g.last = u
+					return u, nil
+				}
+			}
+			return ULID{}, ErrULIDOverflow
+		}
+	}
+	if _, err := io.ReadFull(rand.Reader, u[6:]); err != nil {
+		return ULID{}, err
+	}
+	u.setTime(ms)
+	if g.monotonic {
+		g.ms, g.last = ms, u
+	}
+	return u, nil
+}
+
+// NewULID returns a ULID of the default monotonic generator, it panics when the system random source fails
+func NewULID() ULID {
+	u, err := NewULIDE()
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func NewULIDE() (ULID, error) {
+	return defaultULID.New()
+}
+
+func (u *ULID) setTime(ms uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], ms)
+	copy(u[:6], buf[2:])
+}
+
+func (u ULID) Time() time.Time {
+	var buf [8]byte
+	copy(buf[2:], u[:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(buf[:])))
+}
+
+// String returns the 26 character Crockford base32 encoding
+func (u ULID) String() string {
+	var out [26]byte
+	// 128 bits are encoded as 130 bits, the first character holds the top 3 bits
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// ParseULID is case insensitive and accepts the Crockford aliases O, I and L
+func ParseULID(s string) (ULID, error) {
+	if len(s) != 26 {
+		return ULID{}, fmt.Errorf("%w: %q", ErrInvalidULID, s)
+	}
+	var hi, lo uint64
+	for i := 0; i < len(s); i++ {
+		v := crockfordDecode[s[i]]
+		if v == 0xff || (i == 0 && v > 7) {
+			return ULID{}, fmt.Errorf("%w: %q", ErrInvalidULID, s)
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	var u ULID
+	binary.BigEndian.PutUint64(u[:8], hi)
+	binary.BigEndian.PutUint64(u[8:], lo)
+	return u, nil
+}
+
+func (u ULID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *ULID) UnmarshalText(text []byte) error {
+	parsed, err := ParseULID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
@@ -0,0 +1,157 @@
+package xid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UUID is a RFC 9562 UUID
+type UUID [16]byte
+
+var (
+	NilUUID = UUID{}
+
+	ErrInvalidUUID = errors.New("xid: invalid UUID")
+)
+
+// NewUUIDv4 returns a random UUID, it panics when the system random source fails
+func NewUUIDv4() UUID {
+	u, err := NewUUIDv4E()
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func NewUUIDv4E() (UUID, error) {
+	var u UUID
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return NilUUID, err
+	}
+	u.setVersion(4)
+	return u, nil
+}
+
+// NewUUIDv7 returns a time ordered UUID, it panics when the system random source fails
+func NewUUIDv7() UUID {
+	u, err := NewUUIDv7E()
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// v7 keeps UUIDs of a process increasing with a 12 bit counter in rand_a, RFC 9562 section 6.2 method 1
+var v7 struct {
+	sync.Mutex
+	ms      int64
+	counter uint16
+}
+
+func NewUUIDv7E() (UUID, error) {
+	var u UUID
+	if _, err := io.ReadFull(rand.Reader, u[6:]); err != nil {
+		return NilUUID, err
+	}
+	v7.Lock()
+	ms := time.Now().UnixMilli()
+	if ms > v7.ms {
+		v7.ms = ms
+		// a random start below 2048 leaves room to count
+		v7.counter = binary.BigEndian.Uint16(u[6:8]) & 0x07ff
+	} else {
+		v7.counter++
+		if v7.counter > 0x0fff {
+			// the counter overflowed, borrow the next millisecond
+			v7.ms++
+			v7.counter = 0
+		}
+	}
+	ms, counter := v7.ms, v7.counter
+	v7.Unlock()
+
+	binary.BigEndian.PutUint16(u[4:6], uint16(ms))
+	binary.BigEndian.PutUint32(u[0:4], uint32(ms>>16))
+	binary.BigEndian.PutUint16(u[6:8], counter)
+	u.setVersion(7)
+	return u, nil
+}
+
+func (u *UUID) setVersion(version byte) {
+	u[6] = u[6]&0x0f | version<<4
+	u[8] = u[8]&0x3f | 0x80
+}
+
+// ParseUUID accepts the canonical form, 32 hex digits, braces and the urn:uuid: prefix
+func ParseUUID(s string) (UUID, error) {
+	s = strings.TrimPrefix(strings.ToLower(s), "urn:uuid:")
+	if len(s) == 38 && s[0] == '{' && s[37] == '}' {
+		s = s[1:37]
+	}
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return NilUUID, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+		}
+		s = s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	case 32:
+	default:
+		return NilUUID, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+	}
+	var u UUID
+	if _, err := hex.Decode(u[:], []byte(s)); err != nil {
+		return NilUUID, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+	}
+	return u, nil
+}
+
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+func (u UUID) IsNil() bool {
+	return u == NilUUID
+}
+
+// Time returns the creation time of a version 7 UUID
+func (u UUID) Time() (time.Time, bool) {
+	if u.Version() != 7 {
+		return time.Time{}, false
+	}
+	ms := int64(binary.BigEndian.Uint32(u[0:4]))<<16 | int64(binary.BigEndian.Uint16(u[4:6]))
+	return time.UnixMilli(ms), true
+}
+
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *UUID) UnmarshalText(text []byte) error {
+	parsed, err := ParseUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
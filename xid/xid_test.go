@@ -0,0 +1,192 @@
+package xid
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// generate calls next from several goroutines and requires unique results
+func generate[T comparable](t *testing.T, next func() T) []T {
+	const workers, perWorker = 8, 5000
+	results := make([][]T, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				results[w] = append(results[w], next())
+			}
+		}(w)
+	}
+	wg.Wait()
+	seen := make(map[T]struct{}, workers*perWorker)
+	var all []T
+	for _, ids := range results {
+		for _, id := range ids {
+			_, dup := seen[id]
+			require.False(t, dup, "duplicate %v", id)
+			seen[id] = struct{}{}
+		}
+		all = append(all, ids...)
+	}
+	return all
+}
+
+func TestUUID(t *testing.T) {
+	generate(t, NewUUIDv4)
+	generate(t, NewUUIDv7)
+
+	before := time.Now().Truncate(time.Millisecond)
+	u4, u7 := NewUUIDv4(), NewUUIDv7()
+	require.Equal(t, 4, u4.Version())
+	require.Equal(t, 7, u7.Version())
+	require.Equal(t, byte(0x80), u7[8]&0xc0)
+	_, ok := u4.Time()
+	require.False(t, ok)
+	created, ok := u7.Time()
+	require.True(t, ok)
+	require.False(t, created.Before(before))
+	require.WithinDuration(t, time.Now(), created, time.Second)
+
+	// v7 UUIDs of a process are strictly increasing
+	prev := NewUUIDv7().String()
+	for i := 0; i < 10000; i++ {
+		next := NewUUIDv7().String()
+		require.Less(t, prev, next)
+		prev = next
+	}
+
+	for _, s := range []string{
+		u7.String(),
+		strings.ToUpper(u7.String()),
+		"{" + u7.String() + "}",
+		"urn:uuid:" + u7.String(),
+		strings.ReplaceAll(u7.String(), "-", ""),
+	} {
+		parsed, err := ParseUUID(s)
+		require.NoError(t, err, s)
+		require.Equal(t, u7, parsed)
+	}
+	// RFC 9562 appendix A.6
+	parsed, err := ParseUUID("017f22e2-79b0-7cc3-98c4-dc0c0c07398f")
+	require.NoError(t, err)
+	require.Equal(t, 7, parsed.Version())
+	created, _ = parsed.Time()
+	require.Equal(t, time.Date(2022, 2, 22, 19, 22, 22, 0, time.UTC), created.UTC())
+
+	for _, s := range []string{"", "017f22e2-79b0-7cc3-98c4-dc0c0c07398", "017f22e2x79b0-7cc3-98c4-dc0c0c07398f", "017f22e2-79b0-7cc3-98c4-dc0c0c07398g"} {
+		_, err := ParseUUID(s)
+		require.ErrorIs(t, err, ErrInvalidUUID, s)
+	}
+
+	var decoded UUID
+	text, err := u4.MarshalText()
+	require.NoError(t, err)
+	require.NoError(t, decoded.UnmarshalText(text))
+	require.Equal(t, u4, decoded)
+}
+
+func TestULID(t *testing.T) {
+	generate(t, NewULID)
+	// the default generator is monotonic within a millisecond
+	prev := NewULID().String()
+	for i := 0; i < 10000; i++ {
+		next := NewULID().String()
+		require.Less(t, prev, next)
+		prev = next
+	}
+
+	g := NewULIDGenerator(true)
+	at := time.UnixMilli(1469918176385)
+	first, err := g.NewAt(at)
+	require.NoError(t, err)
+	second, err := g.NewAt(at)
+	require.NoError(t, err)
+	require.Less(t, first.String(), second.String())
+	require.Equal(t, at, second.Time())
+	require.Equal(t, "01ARYZ6S41", first.String()[:10])
+
+	// the random part overflows after the largest value
+	g.last = ULID{}
+	g.last.setTime(uint64(at.UnixMilli()))
+	for i := 6; i < len(g.last); i++ {
+		g.last[i] = 0xff
+	}
+	_, err = g.NewAt(at)
+	require.ErrorIs(t, err, ErrULIDOverflow)
+	// the next millisecond starts over
+	_, err = g.NewAt(at.Add(time.Millisecond))
+	require.NoError(t, err)
+
+	random := NewULIDGenerator(false)
+	a, err := random.NewAt(at)
+	require.NoError(t, err)
+	b, err := random.NewAt(at)
+	require.NoError(t, err)
+	require.NotEqual(t, a, b)
+
+	parsed, err := ParseULID(first.String())
+	require.NoError(t, err)
+	require.Equal(t, first, parsed)
+	parsed, err = ParseULID(strings.ToLower(first.String()))
+	require.NoError(t, err)
+	require.Equal(t, first, parsed)
+	parsed, err = ParseULID("7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	require.NoError(t, err)
+	require.Equal(t, ULID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, parsed)
+	parsed, err = ParseULID("0OIL0000000000000000000000")
+	require.NoError(t, err)
+	require.Equal(t, "00110000000000000000000000", parsed.String())
+
+	for _, s := range []string{"", "01ARYZ6S41", "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", "01ARYZ6S41TSV4RRFFQ69G5FAU"} {
+		_, err := ParseULID(s)
+		require.ErrorIs(t, err, ErrInvalidULID, s)
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	s, err := NewSnowflake(nil)
+	require.NoError(t, err)
+	require.Less(t, s.Node(), int64(1<<DefaultNodeBits))
+
+	ids := generate(t, s.Next)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	require.Greater(t, ids[0], int64(0))
+	for _, id := range ids {
+		parsed := s.Parse(id)
+		require.Equal(t, s.Node(), parsed.Node)
+		require.WithinDuration(t, time.Now(), parsed.Time, 5*time.Second)
+	}
+
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	custom, err := NewSnowflake(&SnowflakeOptions{Epoch: epoch, NodeBits: 5, SequenceBits: 8, Node: 21})
+	require.NoError(t, err)
+	before := time.Now().Truncate(time.Millisecond)
+	prev := custom.Next()
+	for i := 0; i < 2000; i++ {
+		// 256 IDs per millisecond borrow from the following milliseconds
+		next := custom.Next()
+		require.Greater(t, next, prev)
+		prev = next
+	}
+	parsed := custom.Parse(prev)
+	require.Equal(t, int64(21), parsed.Node)
+	require.Less(t, parsed.Sequence, int64(256))
+	require.False(t, parsed.Time.Before(before))
+
+	_, err = NewSnowflake(&SnowflakeOptions{Node: 1024})
+	require.Error(t, err)
+	_, err = NewSnowflake(&SnowflakeOptions{NodeBits: 12, SequenceBits: 12})
+	require.Error(t, err)
+	_, err = NewSnowflake(&SnowflakeOptions{Epoch: time.Now().Add(time.Hour)})
+	require.Error(t, err)
+	derived, err := NewSnowflake(&SnowflakeOptions{NodeBits: 4, Node: -1})
+	require.NoError(t, err)
+	require.Equal(t, DefaultNode(4), derived.Node())
+}
@@ -2,20 +2,32 @@ package xpkg
 
 import (
 	"bytes"
-	"os/exec"
+	"io"
 	"strings"
+
+	"github.com/chaos-plus/chaos-plus-toolx/xcmd"
 )
 
+// MinGoVersion is the first go release supporting "go list -m"
+const MinGoVersion = ">=1.11"
+
 func GetPkgPath(module string) string {
 	v, _ := GetPkgPathE(module)
 	return v
 }
 
 func GetPkgPathE(module string) (string, error) {
-	cmd := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", module)
+	tool, err := xcmd.Require("go", MinGoVersion)
+	if err != nil {
+		return "", err
+	}
 	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	err = xcmd.New().
+		SetCmd(tool.Path).
+		SetArgs([]string{"list", "-m", "-f", "{{.Dir}}", module}).
+		SetStdout(&out).
+		SetStderr(io.Discard).
+		Run()
 	if err != nil {
 		return "", err
 	}